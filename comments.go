@@ -0,0 +1,71 @@
+package Netpbm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// annotations regroupe les commentaires d'en-tête d'une image PBM, PGM, PPM ou PAM.
+// Ils sont lus par les décodeurs et réécrits par Save et Encode.
+type annotations struct {
+	comments      []string
+	recordHistory bool
+}
+
+// Comments retourne les commentaires d'en-tête de l'image, sans le '#'.
+func (a *annotations) Comments() []string {
+	return a.comments
+}
+
+// SetComments remplace les commentaires d'en-tête de l'image.
+func (a *annotations) SetComments(comments []string) {
+	a.comments = append([]string(nil), comments...)
+}
+
+// AddComment ajoute un commentaire d'en-tête. Un commentaire sur plusieurs
+// lignes est écrit sur autant de lignes '#'.
+func (a *annotations) AddComment(comment string) {
+	a.comments = append(a.comments, comment)
+}
+
+// RecordHistory active ou désactive l'historique des traitements : une fois
+// activé, chaque opération (Invert, Flip, Flop, Rotate90CW, SetMaxValue,
+// conversions...) ajoute un commentaire qui la décrit.
+func (a *annotations) RecordHistory(on bool) {
+	a.recordHistory = on
+}
+
+// record ajoute une opération à l'historique s'il est activé.
+func (a *annotations) record(format string, args ...any) {
+	if a.recordHistory {
+		a.comments = append(a.comments, fmt.Sprintf(format, args...))
+	}
+}
+
+// derive retourne une copie des annotations pour une image issue d'une
+// conversion, avec l'opération ajoutée à l'historique.
+func (a *annotations) derive(operation string) annotations {
+	d := annotations{comments: append([]string(nil), a.comments...), recordHistory: a.recordHistory}
+	d.record(operation)
+	return d
+}
+
+// writeComments écrit chaque ligne des commentaires précédée de "# ".
+func writeComments(w io.Writer, comments []string) error {
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment, "\n") {
+			line = strings.TrimRight(line, "\r")
+			var err error
+			if line == "" {
+				_, err = io.WriteString(w, "#\n")
+			} else {
+				_, err = fmt.Fprintf(w, "# %s\n", line)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package Netpbm
+
+import "image"
+
+// Connectivity choisit les voisins d'un pixel : 4 (haut, bas, gauche,
+// droite) ou 8 (diagonales comprises).
+type Connectivity int
+
+const (
+	Connectivity4 Connectivity = 4
+	Connectivity8 Connectivity = 8
+)
+
+// Component décrit une composante connexe de pixels noirs.
+type Component struct {
+	Label                int             // étiquette de la composante dans la carte, à partir de 1
+	Area                 int             // nombre de pixels
+	Bounds               image.Rectangle // plus petit rectangle contenant la composante
+	CentroidX, CentroidY float64         // centre de gravité, au centre des pixels
+	// Perimeter est le nombre de côtés de pixels de la composante qui
+	// touchent un pixel blanc ou le bord de l'image.
+	Perimeter int
+}
+
+// Labeling est le résultat de l'étiquetage des composantes connexes d'une
+// image PBM : une étiquette par pixel, 0 pour le fond, et les statistiques de
+// chaque composante.
+type Labeling struct {
+	width, height int
+	labels        []int // étiquettes ligne par ligne
+	components    []Component
+}
+
+// Label étiquette les composantes connexes de pixels noirs de l'image, dans
+// l'ordre où leur premier pixel apparaît en parcourant l'image ligne par ligne.
+func (pbm *PBM) Label(connectivity Connectivity) *Labeling {
+	l := &Labeling{width: pbm.width, height: pbm.height, labels: make([]int, pbm.width*pbm.height)}
+
+	// Premier passage : étiquettes provisoires et équivalences entre elles.
+	parent := []int{0}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	union := func(a, b int) int {
+		a, b = find(a), find(b)
+		if a > b {
+			a, b = b, a
+		}
+		parent[b] = a
+		return a
+	}
+
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if !pbm.bit(x, y) {
+				continue
+			}
+			label := 0
+			for _, n := range l.previousNeighbors(x, y, connectivity) {
+				if n == 0 {
+					continue
+				}
+				if label == 0 {
+					label = find(n)
+				} else {
+					label = union(label, n)
+				}
+			}
+			if label == 0 {
+				label = len(parent)
+				parent = append(parent, label)
+			}
+			l.labels[y*l.width+x] = label
+		}
+	}
+
+	// Second passage : étiquettes définitives, numérotées à partir de 1.
+	final := make([]int, len(parent))
+	count := 0
+	for i := range l.labels {
+		if l.labels[i] == 0 {
+			continue
+		}
+		root := find(l.labels[i])
+		if final[root] == 0 {
+			count++
+			final[root] = count
+		}
+		l.labels[i] = final[root]
+	}
+
+	l.computeStats(count)
+	return l
+}
+
+// previousNeighbors retourne les étiquettes des voisins déjà parcourus de (x, y).
+func (l *Labeling) previousNeighbors(x, y int, connectivity Connectivity) [4]int {
+	var n [4]int
+	n[0] = l.At(x-1, y)
+	n[1] = l.At(x, y-1)
+	if connectivity == Connectivity8 {
+		n[2] = l.At(x-1, y-1)
+		n[3] = l.At(x+1, y-1)
+	}
+	return n
+}
+
+// computeStats calcule l'aire, le rectangle, le centre de gravité et le périmètre des count composantes.
+func (l *Labeling) computeStats(count int) {
+	l.components = make([]Component, count)
+	sumX := make([]int, count)
+	sumY := make([]int, count)
+	for i := range l.components {
+		l.components[i].Label = i + 1
+	}
+
+	for y := 0; y < l.height; y++ {
+		for x := 0; x < l.width; x++ {
+			label := l.labels[y*l.width+x]
+			if label == 0 {
+				continue
+			}
+			c := &l.components[label-1]
+			pixel := image.Rect(x, y, x+1, y+1)
+			if c.Area == 0 {
+				c.Bounds = pixel
+			} else {
+				c.Bounds = c.Bounds.Union(pixel)
+			}
+			c.Area++
+			sumX[label-1] += x
+			sumY[label-1] += y
+			for _, d := range [4]Point{{X: -1}, {X: 1}, {Y: -1}, {Y: 1}} {
+				if l.At(x+d.X, y+d.Y) != label {
+					c.Perimeter++
+				}
+			}
+		}
+	}
+
+	for i := range l.components {
+		c := &l.components[i]
+		c.CentroidX = float64(sumX[i])/float64(c.Area) + 0.5
+		c.CentroidY = float64(sumY[i])/float64(c.Area) + 0.5
+	}
+}
+
+// Size retourne la largeur et la hauteur de la carte des étiquettes.
+func (l *Labeling) Size() (int, int) {
+	return l.width, l.height
+}
+
+// At retourne l'étiquette du pixel (x, y), 0 pour le fond ou hors de l'image.
+func (l *Labeling) At(x, y int) int {
+	if x >= 0 && x < l.width && y >= 0 && y < l.height {
+		return l.labels[y*l.width+x]
+	}
+	return 0
+}
+
+// Labels retourne la carte des étiquettes, ligne par ligne, partagée avec l.
+func (l *Labeling) Labels() []int {
+	return l.labels
+}
+
+// Components retourne les composantes, celle d'étiquette i à l'indice i-1.
+func (l *Labeling) Components() []Component {
+	return l.components
+}
+
+// Filter retire les composantes de moins de minArea pixels, qui passent dans
+// le fond, et renumérote les autres à partir de 1.
+func (l *Labeling) Filter(minArea int) {
+	renumber := make([]int, len(l.components)+1)
+	kept := l.components[:0]
+	for _, c := range l.components {
+		if c.Area >= minArea {
+			renumber[c.Label] = len(kept) + 1
+			c.Label = len(kept) + 1
+			kept = append(kept, c)
+		}
+	}
+	l.components = kept
+	for i, label := range l.labels {
+		l.labels[i] = renumber[label]
+	}
+}
+
+// ToPBM retourne une image PBM (P1) dont les pixels noirs sont ceux des composantes restantes.
+func (l *Labeling) ToPBM() *PBM {
+	pbm := newPBM(l.width, l.height, "P1")
+	for y := 0; y < l.height; y++ {
+		for x := 0; x < l.width; x++ {
+			if l.labels[y*l.width+x] != 0 {
+				pbm.putBit(x, y, true)
+			}
+		}
+	}
+	return pbm
+}
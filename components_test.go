@@ -0,0 +1,137 @@
+package Netpbm
+
+import (
+	"image"
+	"testing"
+)
+
+// pbmFromRows crée une image PBM dont chaque 'X' de rows est un pixel noir.
+func pbmFromRows(rows ...string) *PBM {
+	pbm := newPBM(len(rows[0]), len(rows), "P1")
+	for y, row := range rows {
+		for x, c := range row {
+			pbm.putBit(x, y, c == 'X')
+		}
+	}
+	return pbm
+}
+
+func TestLabelConnectivity(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        []string
+		four, eight int
+	}{
+		{"diagonal", []string{"X...", ".X..", "..X.", "...X"}, 4, 1},
+		{"anti-diagonal", []string{"...X", "..X.", ".X..", "X..."}, 4, 1},
+		{"checkerboard", []string{"X.X", ".X.", "X.X"}, 5, 1},
+		// Deux étiquettes provisoires fusionnées par la dernière ligne.
+		{"U shape", []string{"X.X", "X.X", "XXX"}, 1, 1},
+		{"W shape", []string{"X.X.X", "X.X.X", "XXXXX"}, 1, 1},
+		{"separate", []string{"XX..X", "XX...", "..XXX"}, 3, 2},
+		{"empty", []string{"...", "..."}, 0, 0},
+	}
+	for _, tt := range tests {
+		pbm := pbmFromRows(tt.rows...)
+		if got := len(pbm.Label(Connectivity4).Components()); got != tt.four {
+			t.Errorf("%s: %d components with 4-connectivity, want %d", tt.name, got, tt.four)
+		}
+		if got := len(pbm.Label(Connectivity8).Components()); got != tt.eight {
+			t.Errorf("%s: %d components with 8-connectivity, want %d", tt.name, got, tt.eight)
+		}
+	}
+}
+
+func TestLabelStatistics(t *testing.T) {
+	pbm := pbmFromRows(
+		"......",
+		"..XXX.",
+		"..XXX.",
+		"......",
+		"XX....",
+	)
+	l := pbm.Label(Connectivity4)
+	want := []Component{
+		{Label: 1, Area: 6, Bounds: image.Rect(2, 1, 5, 3), CentroidX: 3.5, CentroidY: 2, Perimeter: 10},
+		// Les côtés sur le bord de l'image comptent dans le périmètre.
+		{Label: 2, Area: 2, Bounds: image.Rect(0, 4, 2, 5), CentroidX: 1, CentroidY: 4.5, Perimeter: 6},
+	}
+	got := l.Components()
+	if len(got) != len(want) {
+		t.Fatalf("%d components, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("component %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if l.At(3, 2) != 1 || l.At(1, 4) != 2 || l.At(0, 0) != 0 || l.At(-1, 0) != 0 {
+		t.Errorf("unexpected labels: %v", l.Labels())
+	}
+}
+
+func TestLabelPerimeterWithHole(t *testing.T) {
+	// Un anneau 3×3 : 12 côtés extérieurs et 4 côtés autour du trou.
+	l := pbmFromRows(
+		".....",
+		".XXX.",
+		".X.X.",
+		".XXX.",
+		".....",
+	).Label(Connectivity4)
+	if c := l.Components()[0]; c.Area != 8 || c.Perimeter != 16 || c.CentroidX != 2.5 || c.CentroidY != 2.5 {
+		t.Errorf("ring is %+v, want area 8, perimeter 16, centroid (2.5, 2.5)", c)
+	}
+}
+
+func TestLabelingFilter(t *testing.T) {
+	pbm := pbmFromRows(
+		"X...XX",
+		"..X.XX",
+		"..X...",
+		"......",
+		"X.XXXX",
+	)
+	l := pbm.Label(Connectivity4)
+	// Composantes dans l'ordre : 1 pixel, 4 pixels, 2 pixels, 1 pixel, 4 pixels.
+	if got := len(l.Components()); got != 5 {
+		t.Fatalf("%d components before Filter, want 5", got)
+	}
+
+	l.Filter(2)
+	components := l.Components()
+	wantAreas := []int{4, 2, 4}
+	if len(components) != len(wantAreas) {
+		t.Fatalf("%d components after Filter, want %d", len(components), len(wantAreas))
+	}
+	for i, c := range components {
+		if c.Label != i+1 || c.Area != wantAreas[i] {
+			t.Errorf("component %d has label %d and area %d, want label %d and area %d", i, c.Label, c.Area, i+1, wantAreas[i])
+		}
+	}
+
+	// Les étiquettes restantes sont contiguës et les pixels retirés passent dans le fond.
+	areas := make([]int, len(components)+1)
+	for _, label := range l.Labels() {
+		if label < 0 || label > len(components) {
+			t.Fatalf("label %d out of range after Filter", label)
+		}
+		areas[label]++
+	}
+	for i, c := range components {
+		if areas[i+1] != c.Area {
+			t.Errorf("label %d covers %d pixels, want %d", i+1, areas[i+1], c.Area)
+		}
+	}
+	if l.At(0, 0) != 0 || l.At(0, 4) != 0 {
+		t.Errorf("removed components still labeled: %v", l.Labels())
+	}
+
+	checkSamePixels(t, "ToPBM after Filter", l.ToPBM(), pbmFromRows(
+		"....XX",
+		"..X.XX",
+		"..X...",
+		"......",
+		"..XXXX",
+	))
+}
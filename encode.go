@@ -0,0 +1,183 @@
+package Netpbm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Separator choisit ce qui sépare les échantillons des formats ASCII (P1, P2, P3).
+type Separator int
+
+const (
+	// SeparatorSpace sépare les échantillons par un espace (par défaut).
+	SeparatorSpace Separator = iota
+	// SeparatorNewline écrit un échantillon par ligne.
+	SeparatorNewline
+	// SeparatorNone accole les chiffres d'une image P1, comme "0110" ; les
+	// autres formats, dont les échantillons ont plusieurs chiffres, gardent
+	// l'espace.
+	SeparatorNone
+)
+
+// DefaultLineLength est la longueur maximale d'une ligne ASCII imposée par la
+// spécification Netpbm.
+const DefaultLineLength = 70
+
+// EncodeOptions règle la mise en page des formats ASCII (P1, P2, P3) et
+// l'écriture des commentaires. La valeur zéro, comme un *EncodeOptions nil,
+// produit des fichiers conformes : lignes d'au plus 70 caractères,
+// échantillons séparés par un espace, chaque ligne d'image commençant sur une
+// nouvelle ligne, commentaires écrits.
+type EncodeOptions struct {
+	// LineLength est la longueur maximale d'une ligne ASCII : 0 pour
+	// DefaultLineLength, une valeur négative pour ne couper les lignes
+	// qu'à la fin de chaque ligne d'image.
+	LineLength int
+	Separator  Separator
+	// OmitComments supprime les commentaires d'en-tête de la sortie.
+	OmitComments bool
+}
+
+// Encode écrit img dans w selon les options o. Les options ne concernent que
+// les images PBM, PGM et PPM ; les autres sont écrites par leur méthode Encode.
+func (o *EncodeOptions) Encode(w io.Writer, img Image) error {
+	switch img := img.(type) {
+	case *PBM:
+		return img.encode(w, o)
+	case *PGM:
+		return img.encode(w, o)
+	case *PPM:
+		return img.encode(w, o)
+	}
+	return img.Encode(w)
+}
+
+// Save enregistre img dans un fichier selon les options o.
+func (o *EncodeOptions) Save(img Image, filename string) error {
+	return saveFile(filename, func(w io.Writer) error {
+		return o.Encode(w, img)
+	})
+}
+
+// saveFile écrit un fichier de manière atomique : encode écrit, à travers un
+// tampon, dans un fichier temporaire du même répertoire, qui remplace
+// filename une fois vidé, synchronisé sur le disque et fermé. En cas
+// d'erreur, le fichier temporaire est supprimé et filename reste intact.
+func saveFile(filename string, encode func(w io.Writer) error) (err error) {
+	// Conserver les permissions d'un fichier existant.
+	mode := os.FileMode(0o644)
+	if info, statErr := os.Stat(filename); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(file)
+	if err = encode(writer); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	if err = file.Chmod(mode); err != nil {
+		return fmt.Errorf("error setting file mode: %v", err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %v", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("error closing file: %v", err)
+	}
+	if err = os.Rename(file.Name(), filename); err != nil {
+		return fmt.Errorf("error renaming file: %v", err)
+	}
+	return nil
+}
+
+// header retourne h sans ses commentaires si o demande de les omettre.
+func (o *EncodeOptions) header(h Header) *Header {
+	if o != nil && o.OmitComments {
+		h.Comments = nil
+	}
+	return &h
+}
+
+// plainWriter écrit les échantillons d'un raster ASCII en respectant la
+// longueur de ligne et le séparateur choisis.
+type plainWriter struct {
+	w         *bufio.Writer
+	maxLength int  // longueur maximale d'une ligne, 0 sans limite
+	separator byte // ' ', '\n' ou 0 pour des chiffres accolés
+	length    int  // longueur de la ligne en cours
+	buf       []byte
+}
+
+// newPlainWriter crée un plainWriter pour un raster au format magicNumber.
+func newPlainWriter(w *bufio.Writer, magicNumber string, o *EncodeOptions) *plainWriter {
+	pw := &plainWriter{w: w, maxLength: DefaultLineLength, separator: ' '}
+	if o == nil {
+		return pw
+	}
+	if o.LineLength > 0 {
+		pw.maxLength = o.LineLength
+	} else if o.LineLength < 0 {
+		pw.maxLength = 0
+	}
+	switch {
+	case o.Separator == SeparatorNewline:
+		pw.separator = '\n'
+	case o.Separator == SeparatorNone && magicNumber == "P1":
+		pw.separator = 0
+	}
+	return pw
+}
+
+// writeSample écrit un échantillon, précédé du séparateur ou d'un saut de
+// ligne si la ligne en cours deviendrait trop longue.
+func (pw *plainWriter) writeSample(value uint16) error {
+	pw.buf = strconv.AppendUint(pw.buf[:0], uint64(value), 10)
+	if pw.length > 0 {
+		sep := pw.separator
+		need := len(pw.buf)
+		if sep != 0 {
+			need++
+		}
+		if sep == '\n' || (pw.maxLength > 0 && pw.length+need > pw.maxLength) {
+			sep = '\n'
+			pw.length = 0
+		}
+		if sep != 0 {
+			if err := pw.w.WriteByte(sep); err != nil {
+				return err
+			}
+			if sep != '\n' {
+				pw.length++
+			}
+		}
+	}
+	_, err := pw.w.Write(pw.buf)
+	pw.length += len(pw.buf)
+	return err
+}
+
+// endRow termine la ligne d'image en cours par un saut de ligne.
+func (pw *plainWriter) endRow() error {
+	if pw.length == 0 {
+		return nil
+	}
+	pw.length = 0
+	return pw.w.WriteByte('\n')
+}
@@ -0,0 +1,62 @@
+package Netpbm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Catégories d'erreurs de décodage, à tester avec errors.Is.
+var (
+	ErrInvalidMagic     = errors.New("invalid magic number")
+	ErrTruncated        = errors.New("unexpected end of file")
+	ErrBadHeader        = errors.New("invalid header")
+	ErrBadSample        = errors.New("invalid sample")
+	ErrSampleOutOfRange = errors.New("sample out of range")
+	ErrTooLarge         = errors.New("image exceeds decode limits")
+	ErrTrailingData     = errors.New("trailing data after raster")
+	ErrMissingSpace     = errors.New("missing whitespace")
+)
+
+// DecodeError décrit une erreur de décodage et sa position dans le flux. Elle
+// s'obtient avec errors.As et se compare à sa catégorie avec errors.Is.
+type DecodeError struct {
+	Err    error  // catégorie (ErrInvalidMagic, ErrTruncated...) ou erreur d'E/S sous-jacente
+	Msg    string // description détaillée
+	Offset int64  // position en octets dans le flux
+	Row    int    // ligne du raster, -1 si l'erreur est dans l'en-tête
+	Column int    // colonne du raster, -1 si l'erreur est dans l'en-tête ou porte sur une ligne entière
+}
+
+// Error retourne la description de l'erreur avec sa position.
+func (e *DecodeError) Error() string {
+	switch {
+	case e.Row >= 0 && e.Column >= 0:
+		return fmt.Sprintf("%s at row %d, column %d (offset %d)", e.Msg, e.Row, e.Column, e.Offset)
+	case e.Row >= 0:
+		return fmt.Sprintf("%s at row %d (offset %d)", e.Msg, e.Row, e.Offset)
+	}
+	return fmt.Sprintf("%s (offset %d)", e.Msg, e.Offset)
+}
+
+// Unwrap retourne la catégorie de l'erreur.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// errorf construit une DecodeError de catégorie kind à la position courante du flux.
+func (t *tokenReader) errorf(kind error, row, column int, format string, args ...any) error {
+	return &DecodeError{Err: kind, Msg: fmt.Sprintf(format, args...), Offset: t.off, Row: row, Column: column}
+}
+
+// ioError classe une erreur de lecture : fin de flux prématurée (ErrTruncated),
+// limite MaxBytes atteinte (ErrTooLarge) ou erreur d'E/S transmise telle quelle.
+func (t *tokenReader) ioError(err error, row, column int, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return t.errorf(ErrTruncated, row, column, "unexpected end of file reading %s", what)
+	}
+	if err == ErrTooLarge {
+		return t.errorf(ErrTooLarge, row, column, "byte limit %d reached reading %s", t.opts.MaxBytes, what)
+	}
+	return t.errorf(err, row, column, "error reading %s: %v", what, err)
+}
@@ -0,0 +1,121 @@
+package Netpbm
+
+// FloodFill remplit de value la zone de pixels de même valeur que p qui lui
+// est reliée selon connectivity, comme le pot de peinture d'un logiciel de
+// dessin. Un point hors de l'image ne remplit rien.
+func (pbm *PBM) FloodFill(p Point, value bool, connectivity Connectivity) {
+	if p.X < 0 || p.X >= pbm.width || p.Y < 0 || p.Y >= pbm.height {
+		return
+	}
+	seed := pbm.bit(p.X, p.Y)
+	floodFill(pbm.width, pbm.height, p, connectivity,
+		func(x, y int) bool { return pbm.bit(x, y) == seed },
+		func(x, y int) { pbm.putBit(x, y, value) })
+	pbm.record("FloodFill at (%d, %d)", p.X, p.Y)
+}
+
+// FloodFill remplit de value la zone reliée à p selon connectivity dont les
+// pixels diffèrent d'au plus tolerance de la valeur de p. Un point hors de
+// l'image ne remplit rien.
+func (pgm *PGM) FloodFill(p Point, value uint16, connectivity Connectivity, tolerance uint16) {
+	if p.X < 0 || p.X >= pgm.width || p.Y < 0 || p.Y >= pgm.height {
+		return
+	}
+	seed := pgm.value(p.X, p.Y)
+	value = min(value, uint16(pgm.max))
+	floodFill(pgm.width, pgm.height, p, connectivity,
+		func(x, y int) bool { return sampleDistance(pgm.value(x, y), seed) <= tolerance },
+		func(x, y int) { pgm.putValue(x, y, value) })
+	pgm.record("FloodFill at (%d, %d)", p.X, p.Y)
+}
+
+// FloodFill remplit de color la zone reliée à p selon connectivity dont
+// chaque composante des pixels diffère d'au plus tolerance de celle de p. Un
+// point hors de l'image ne remplit rien.
+func (ppm *PPM) FloodFill(p Point, color Pixel, connectivity Connectivity, tolerance uint16) {
+	if p.X < 0 || p.X >= ppm.width || p.Y < 0 || p.Y >= ppm.height {
+		return
+	}
+	seed := ppm.pixel(p.X, p.Y)
+	color = ppm.clamp(color)
+	floodFill(ppm.width, ppm.height, p, connectivity,
+		func(x, y int) bool {
+			pixel := ppm.pixel(x, y)
+			return sampleDistance(pixel.R, seed.R) <= tolerance &&
+				sampleDistance(pixel.G, seed.G) <= tolerance &&
+				sampleDistance(pixel.B, seed.B) <= tolerance
+		},
+		func(x, y int) { ppm.putPixel(x, y, color) })
+	ppm.record("FloodFill at (%d, %d)", p.X, p.Y)
+}
+
+// sampleDistance retourne l'écart entre deux échantillons.
+func sampleDistance(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// floodFill remplit par fill la zone de pixels vérifiant inside reliée à
+// seed. Les segments horizontaux à remplir sont gérés par une pile plutôt que
+// par récursion, pour qu'une grande zone ne fasse pas déborder la pile
+// d'appels. Chaque pixel n'est testé qu'une fois, ce qui permet à inside de
+// comparer les valeurs d'origine même quand la nouvelle valeur y répond aussi.
+func floodFill(width, height int, seed Point, connectivity Connectivity, inside func(x, y int) bool, fill func(x, y int)) {
+	visited := newPBM(width, height, "P1")
+	accept := func(x, y int) bool {
+		if visited.bit(x, y) {
+			return false
+		}
+		visited.putBit(x, y, true)
+		return inside(x, y)
+	}
+
+	// En 8-connexité, les lignes voisines sont explorées un pixel plus loin
+	// de chaque côté, pour suivre les diagonales.
+	reach := 0
+	if connectivity == Connectivity8 {
+		reach = 1
+	}
+
+	if !accept(seed.X, seed.Y) {
+		return
+	}
+	stack := []Point{seed}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Étendre le segment de p vers la gauche et vers la droite.
+		left, right := p.X, p.X
+		for left > 0 && accept(left-1, p.Y) {
+			left--
+		}
+		for right < width-1 && accept(right+1, p.Y) {
+			right++
+		}
+		for x := left; x <= right; x++ {
+			fill(x, p.Y)
+		}
+
+		// Empiler un pixel de départ par segment à remplir des lignes voisines.
+		for _, y := range [2]int{p.Y - 1, p.Y + 1} {
+			if y < 0 || y >= height {
+				continue
+			}
+			inRun := false
+			for x := max(left-reach, 0); x <= min(right+reach, width-1); x++ {
+				if !visited.bit(x, y) && inside(x, y) {
+					if !inRun {
+						visited.putBit(x, y, true)
+						stack = append(stack, Point{X: x, Y: y})
+						inRun = true
+					}
+				} else {
+					inRun = false
+				}
+			}
+		}
+	}
+}
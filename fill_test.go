@@ -0,0 +1,157 @@
+package Netpbm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// referenceFill retourne, par un parcours en largeur naïf, les pixels de la
+// zone vérifiant inside reliée à seed.
+func referenceFill(width, height int, seed Point, connectivity Connectivity, inside func(x, y int) bool) []bool {
+	filled := make([]bool, width*height)
+	filled[seed.Y*width+seed.X] = true
+	queue := []Point{seed}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dx == 0 && dy == 0) || (connectivity == Connectivity4 && dx != 0 && dy != 0) {
+					continue
+				}
+				x, y := p.X+dx, p.Y+dy
+				if x < 0 || x >= width || y < 0 || y >= height || filled[y*width+x] || !inside(x, y) {
+					continue
+				}
+				filled[y*width+x] = true
+				queue = append(queue, Point{X: x, Y: y})
+			}
+		}
+	}
+	return filled
+}
+
+var connectivities = []Connectivity{Connectivity4, Connectivity8}
+
+func TestPBMFloodFill(t *testing.T) {
+	for _, width := range testWidths {
+		for _, connectivity := range connectivities {
+			for i := 0; i < 10; i++ {
+				src := randomPBM(width, 9, int64(width*10+i))
+				seed := Point{X: (i * 13) % width, Y: i % 9}
+				value := !src.bit(seed.X, seed.Y)
+				filled := referenceFill(width, 9, seed, connectivity, func(x, y int) bool {
+					return src.bit(x, y) == src.bit(seed.X, seed.Y)
+				})
+
+				got := src.clone()
+				got.FloodFill(seed, value, connectivity)
+				checkPadding(t, got)
+				for y := 0; y < 9; y++ {
+					for x := 0; x < width; x++ {
+						want := src.bit(x, y)
+						if filled[y*width+x] {
+							want = value
+						}
+						if got.bit(x, y) != want {
+							t.Fatalf("width %d, %d-connectivity, seed %v: pixel (%d, %d) is %v, want %v",
+								width, connectivity, seed, x, y, got.bit(x, y), want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPGMFloodFillTolerance(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, connectivity := range connectivities {
+		for i := 0; i < 200; i++ {
+			width, height := 1+r.Intn(40), 1+r.Intn(20)
+			src := newPGM(width, height, "P2", 15)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					src.putValue(x, y, uint16(r.Intn(6)))
+				}
+			}
+			seed := Point{X: r.Intn(width), Y: r.Intn(height)}
+			tolerance := uint16(r.Intn(3))
+			// La nouvelle valeur reste le plus souvent dans la tolérance :
+			// un pixel déjà rempli ne doit pas être parcouru à nouveau.
+			value := src.value(seed.X, seed.Y) + uint16(r.Intn(int(tolerance)+1))
+			origin := src.value(seed.X, seed.Y)
+			filled := referenceFill(width, height, seed, connectivity, func(x, y int) bool {
+				return sampleDistance(src.value(x, y), origin) <= tolerance
+			})
+
+			got := newPGM(width, height, "P2", 15)
+			copy(got.pix, src.pix)
+			got.FloodFill(seed, value, connectivity, tolerance)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					want := src.value(x, y)
+					if filled[y*width+x] {
+						want = value
+					}
+					if got.value(x, y) != want {
+						t.Fatalf("case %d, %d-connectivity: pixel (%d, %d) is %d, want %d", i, connectivity, x, y, got.value(x, y), want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPPMFloodFillTolerance(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, connectivity := range connectivities {
+		for i := 0; i < 200; i++ {
+			width, height := 1+r.Intn(30), 1+r.Intn(20)
+			src := newPPM(width, height, "P3", 255)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					src.putPixel(x, y, Pixel{R: uint16(100 + r.Intn(4)), G: 50, B: uint16(r.Intn(3))})
+				}
+			}
+			seed := Point{X: r.Intn(width), Y: r.Intn(height)}
+			origin := src.pixel(seed.X, seed.Y)
+			// La nouvelle couleur est dans la tolérance de la couleur d'origine.
+			color := Pixel{R: origin.R + 1, G: origin.G, B: origin.B}
+			filled := referenceFill(width, height, seed, connectivity, func(x, y int) bool {
+				p := src.pixel(x, y)
+				return sampleDistance(p.R, origin.R) <= 1 && sampleDistance(p.G, origin.G) <= 1 && sampleDistance(p.B, origin.B) <= 1
+			})
+
+			got := newPPM(width, height, "P3", 255)
+			copy(got.pix, src.pix)
+			got.FloodFill(seed, color, connectivity, 1)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					want := src.pixel(x, y)
+					if filled[y*width+x] {
+						want = color
+					}
+					if got.pixel(x, y) != want {
+						t.Fatalf("case %d, %d-connectivity: pixel (%d, %d) is %v, want %v", i, connectivity, x, y, got.pixel(x, y), want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFloodFillLargeRegion(t *testing.T) {
+	// Une zone de plusieurs millions de pixels ne doit pas épuiser la pile.
+	pbm := newPBM(2000, 1500, "P1")
+	pbm.FloodFill(Point{X: 1000, Y: 750}, true, Connectivity4)
+	checkSamePixels(t, "large fill", pbm, blackKernel(2000, 1500))
+}
+
+func TestFloodFillOutside(t *testing.T) {
+	pbm := randomPBM(10, 10, 3)
+	want := pbm.clone()
+	pbm.FloodFill(Point{X: -1, Y: 5}, true, Connectivity8)
+	pbm.FloodFill(Point{X: 5, Y: 10}, true, Connectivity8)
+	checkSamePixels(t, "fill outside", pbm, want)
+}
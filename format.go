@@ -0,0 +1,99 @@
+package Netpbm
+
+import (
+	"image"
+	"image/color"
+	"io"
+)
+
+// Enregistrer chaque magic number auprès du paquet image, pour que image.Decode
+// et image.DecodeConfig reconnaissent les fichiers Netpbm dès que ce paquet est
+// importé, y compris avec un import blanc.
+func init() {
+	image.RegisterFormat("pbm", "P1", decodePBMImage, decodeImageConfig)
+	image.RegisterFormat("pbm", "P4", decodePBMImage, decodeImageConfig)
+	image.RegisterFormat("pgm", "P2", decodePGMImage, decodeImageConfig)
+	image.RegisterFormat("pgm", "P5", decodePGMImage, decodeImageConfig)
+	image.RegisterFormat("ppm", "P3", decodePPMImage, decodeImageConfig)
+	image.RegisterFormat("ppm", "P6", decodePPMImage, decodeImageConfig)
+	image.RegisterFormat("pam", "P7", decodePAMImage, decodeImageConfig)
+	image.RegisterFormat("pfm", "PF", decodePFMImage, decodeImageConfig)
+	image.RegisterFormat("pfm", "Pf", decodePFMImage, decodeImageConfig)
+}
+
+// magicNumbers liste tous les magic numbers pris en charge par le paquet.
+var magicNumbers = []string{"P1", "P2", "P3", "P4", "P5", "P6", "P7", "PF", "Pf"}
+
+// decodeImageConfig lit uniquement l'en-tête et retourne les dimensions et le modèle de couleur de l'image.
+func decodeImageConfig(r io.Reader) (image.Config, error) {
+	h, err := DecodeConfig(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.Width, Height: h.Height}, nil
+}
+
+// colorModel retourne le modèle de couleur qu'aura l'image décrite par l'en-tête.
+func (h *Header) colorModel() color.Model {
+	switch h.MagicNumber {
+	case "P1", "P4":
+		return color.GrayModel
+	case "P2", "P5":
+		if h.MaxValue > 255 {
+			return color.Gray16Model
+		}
+		return color.GrayModel
+	case "P3", "P6":
+		if h.MaxValue > 255 {
+			return color.RGBA64Model
+		}
+		return color.RGBAModel
+	case "PF":
+		return color.RGBA64Model
+	case "Pf":
+		return color.Gray16Model
+	}
+	return color.NRGBA64Model
+}
+
+// Les fonctions suivantes adaptent les décodeurs à la signature attendue par image.RegisterFormat.
+
+func decodePBMImage(r io.Reader) (image.Image, error) {
+	pbm, err := DecodePBM(r)
+	if err != nil {
+		return nil, err
+	}
+	return pbm, nil
+}
+
+func decodePGMImage(r io.Reader) (image.Image, error) {
+	pgm, err := DecodePGM(r)
+	if err != nil {
+		return nil, err
+	}
+	return pgm, nil
+}
+
+func decodePPMImage(r io.Reader) (image.Image, error) {
+	ppm, err := DecodePPM(r)
+	if err != nil {
+		return nil, err
+	}
+	return ppm, nil
+}
+
+func decodePAMImage(r io.Reader) (image.Image, error) {
+	pam, err := DecodePAM(r)
+	if err != nil {
+		return nil, err
+	}
+	return pam, nil
+}
+
+func decodePFMImage(r io.Reader) (image.Image, error) {
+	pfm, err := DecodePFM(r)
+	if err != nil {
+		return nil, err
+	}
+	return pfm, nil
+}
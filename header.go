@@ -0,0 +1,474 @@
+package Netpbm
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Header décrit l'en-tête d'une image Netpbm, sans son raster.
+type Header struct {
+	MagicNumber   string
+	Width, Height int
+	Depth         int // échantillons par pixel : 1 pour PBM/PGM/Pf, 3 pour PPM/PF, DEPTH pour PAM
+	MaxValue      uint
+	TupleType     string  // PAM uniquement
+	Scale         float64 // PFM uniquement, négatif pour little-endian
+	Comments      []string
+	// RasterOffset est la position en octets du début du raster. Pour les
+	// formats ASCII, c'est la position qui suit le dernier token de l'en-tête.
+	RasterOffset int64
+}
+
+// ReadHeader lit uniquement l'en-tête d'un fichier Netpbm, sans charger les pixels.
+func ReadHeader(filename string) (*Header, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return DecodeConfig(file)
+}
+
+// DecodeConfig lit l'en-tête d'une image Netpbm (P1 à P7, PF ou Pf) depuis r et s'arrête avant le raster.
+func DecodeConfig(r io.Reader) (*Header, error) {
+	return newTokenReader(r, nil).readHeader(magicNumbers...)
+}
+
+// tokenReader découpe un flux Netpbm en tokens selon la spécification :
+// les tokens sont séparés par des blancs et un '#' démarre un commentaire
+// qui court jusqu'à la fin de la ligne, n'importe où dans l'en-tête.
+type tokenReader struct {
+	r        *bufio.Reader
+	off      int64    // nombre d'octets consommés depuis le début du flux
+	comments []string // commentaires rencontrés, sans le '#'
+	opts     *DecodeOptions
+	start    int64 // position du début de l'image courante, pour MaxBytes
+}
+
+// newTokenReader crée un tokenReader sur r en réutilisant le tampon de r si
+// c'en est déjà un. opts peut être nil.
+func newTokenReader(r io.Reader, opts *DecodeOptions) *tokenReader {
+	return &tokenReader{r: bufio.NewReader(r), opts: opts}
+}
+
+// remaining retourne le nombre d'octets que l'image courante peut encore
+// lire d'après MaxBytes, ou -1 sans limite.
+func (t *tokenReader) remaining() int64 {
+	if t.opts == nil || t.opts.MaxBytes <= 0 {
+		return -1
+	}
+	return t.opts.MaxBytes - (t.off - t.start)
+}
+
+// isSpace indique si c est un blanc au sens de la spécification Netpbm.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// readByte lit un octet en tenant à jour la position dans le flux.
+func (t *tokenReader) readByte() (byte, error) {
+	if t.remaining() == 0 {
+		return 0, ErrTooLarge
+	}
+	c, err := t.r.ReadByte()
+	if err == nil {
+		t.off++
+	}
+	return c, err
+}
+
+// unreadByte remet le dernier octet lu dans le flux.
+func (t *tokenReader) unreadByte() {
+	if t.r.UnreadByte() == nil {
+		t.off--
+	}
+}
+
+// read remplit entièrement p avec les octets suivants du flux.
+func (t *tokenReader) read(p []byte) (int, error) {
+	if n := t.remaining(); n >= 0 && int64(len(p)) > n {
+		return 0, ErrTooLarge
+	}
+	n, err := io.ReadFull(t.r, p)
+	t.off += int64(n)
+	return n, err
+}
+
+// skipComment consomme un commentaire jusqu'à la fin de la ligne incluse et le mémorise.
+func (t *tokenReader) skipComment() error {
+	var buf []byte
+	for {
+		c, err := t.readByte()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF || c == '\n' || c == '\r' {
+			t.comments = append(t.comments, strings.TrimSpace(string(buf)))
+			return err
+		}
+		buf = append(buf, c)
+	}
+}
+
+// skipSpace ignore les blancs et les commentaires et retourne le premier
+// octet qui suit, consommé.
+func (t *tokenReader) skipSpace() (byte, error) {
+	for {
+		c, err := t.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if c == '#' {
+			if err = t.skipComment(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if !isSpace(c) {
+			return c, nil
+		}
+	}
+}
+
+// token retourne le prochain token en ignorant les blancs et les commentaires.
+// Le blanc qui termine le token n'est pas consommé.
+func (t *tokenReader) token() (string, error) {
+	c, err := t.skipSpace()
+	if err != nil {
+		return "", err
+	}
+
+	// Accumuler les octets jusqu'au prochain blanc ou commentaire.
+	buf := []byte{c}
+	for {
+		c, err = t.readByte()
+		if err == io.EOF {
+			return string(buf), nil
+		}
+		if err == ErrTooLarge && t.atDelimiter() {
+			// Le token se termine exactement à la limite MaxBytes.
+			return string(buf), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if isSpace(c) || c == '#' {
+			t.unreadByte()
+			return string(buf), nil
+		}
+		buf = append(buf, c)
+	}
+}
+
+// atDelimiter indique si le prochain octet du flux, sans le consommer, termine un token.
+func (t *tokenReader) atDelimiter() bool {
+	next, err := t.r.Peek(1)
+	return err == io.EOF || (err == nil && (isSpace(next[0]) || next[0] == '#'))
+}
+
+// atEOF indique, sans rien consommer, si le flux est terminé.
+func (t *tokenReader) atEOF() bool {
+	_, err := t.r.Peek(1)
+	return err == io.EOF
+}
+
+// readLine lit une ligne complète, sans le saut de ligne final.
+func (t *tokenReader) readLine() (string, error) {
+	var buf []byte
+	for {
+		c, err := t.readByte()
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				return string(buf), nil
+			}
+			return "", err
+		}
+		if c == '\n' {
+			return string(buf), nil
+		}
+		buf = append(buf, c)
+	}
+}
+
+// readUint lit le prochain token et le convertit en entier positif ou nul.
+func (t *tokenReader) readUint(name string) (int, error) {
+	tok, err := t.token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, t.ioError(err, -1, -1, name)
+	}
+	value, err := strconv.ParseUint(tok, 10, 31)
+	if err != nil {
+		return 0, t.errorf(ErrBadHeader, -1, -1, "invalid %s: %q", name, tok)
+	}
+	return int(value), nil
+}
+
+// readMagicNumber lit les deux octets du magic number, qui doivent être suivis d'un blanc ou d'un commentaire.
+func (t *tokenReader) readMagicNumber() (string, error) {
+	magic := make([]byte, 2)
+	if _, err := t.read(magic); err != nil {
+		return "", t.ioError(err, -1, -1, "magic number")
+	}
+	c, err := t.readByte()
+	if err != nil {
+		return "", t.ioError(err, -1, -1, "magic number")
+	}
+	t.unreadByte()
+	if !isSpace(c) && c != '#' {
+		// Un chiffre accolé au magic number est le début de la largeur ; tout
+		// autre octet signifie que ce n'est pas un magic number.
+		if c < '0' || c > '9' {
+			return "", t.errorf(ErrInvalidMagic, -1, -1, "invalid magic number: %q", string(magic)+string(c))
+		}
+		if err := t.offSpec(ErrMissingSpace, -1, -1, "missing whitespace after magic number %q", magic); err != nil {
+			return "", err
+		}
+	}
+	return string(magic), nil
+}
+
+// readHeader lit l'en-tête complet d'une image Netpbm dont le magic number
+// fait partie de accepted. Pour les formats binaires, l'unique blanc qui
+// sépare l'en-tête du raster est consommé.
+func (t *tokenReader) readHeader(accepted ...string) (*Header, error) {
+	magicNumber, err := t.readMagicNumber()
+	if err != nil {
+		return nil, err
+	}
+	valid := false
+	for _, m := range accepted {
+		if m == magicNumber {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, t.errorf(ErrInvalidMagic, -1, -1, "invalid magic number: %q", magicNumber)
+	}
+
+	h := &Header{MagicNumber: magicNumber, Depth: 1, MaxValue: 1}
+	switch magicNumber {
+	case "P7":
+		err = t.readPAMHeader(h)
+	case "PF", "Pf":
+		err = t.readPFMHeader(h)
+	default:
+		err = t.readPNMHeader(h)
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.Comments = t.comments
+	h.RasterOffset = t.off
+	if err := t.checkLimits(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// readPNMHeader lit la suite de l'en-tête d'une image PBM, PGM ou PPM.
+func (t *tokenReader) readPNMHeader(h *Header) error {
+	var err error
+
+	// Lire les dimensions.
+	if h.Width, err = t.readUint("width"); err != nil {
+		return err
+	}
+	if h.Height, err = t.readUint("height"); err != nil {
+		return err
+	}
+	if h.Width <= 0 || h.Height <= 0 {
+		return t.errorf(ErrBadHeader, -1, -1, "invalid dimensions: width and height must be positive")
+	}
+
+	// Lire la valeur maximale, absente des PBM.
+	if h.MagicNumber != "P1" && h.MagicNumber != "P4" {
+		max, err := t.readUint("max value")
+		if err != nil {
+			return err
+		}
+		if max <= 0 || max > 65535 {
+			return t.errorf(ErrBadHeader, -1, -1, "invalid max value: %d", max)
+		}
+		h.MaxValue = uint(max)
+	}
+	if h.MagicNumber == "P3" || h.MagicNumber == "P6" {
+		h.Depth = 3
+	}
+
+	// Les formats binaires séparent l'en-tête du raster par un seul blanc.
+	if h.MagicNumber == "P4" || h.MagicNumber == "P5" || h.MagicNumber == "P6" {
+		return t.readRasterSeparator()
+	}
+	return nil
+}
+
+// readPAMHeader lit les lignes "MOT-CLÉ valeur" d'un en-tête PAM jusqu'à ENDHDR.
+func (t *tokenReader) readPAMHeader(h *Header) error {
+	// Terminer la ligne du magic number.
+	if _, err := t.readLine(); err != nil {
+		return t.ioError(err, -1, -1, "header")
+	}
+
+	width, height, depth, max := -1, -1, -1, -1
+	var tupleTypes []string
+
+	for {
+		line, err := t.readLine()
+		if err != nil {
+			return t.ioError(err, -1, -1, "header")
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			t.comments = append(t.comments, strings.TrimSpace(line[1:]))
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if line == "ENDHDR" {
+			break
+		}
+
+		fields := strings.Fields(line)
+		keyword := fields[0]
+		if keyword == "TUPLTYPE" {
+			// Les lignes TUPLTYPE multiples sont concaténées avec un espace.
+			tupleTypes = append(tupleTypes, strings.TrimSpace(strings.TrimPrefix(line, keyword)))
+			continue
+		}
+		if len(fields) != 2 {
+			return t.errorf(ErrBadHeader, -1, -1, "invalid header line: %q", line)
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 31)
+		if err != nil {
+			return t.errorf(ErrBadHeader, -1, -1, "invalid %s: %q", keyword, fields[1])
+		}
+		switch keyword {
+		case "WIDTH":
+			width = int(value)
+		case "HEIGHT":
+			height = int(value)
+		case "DEPTH":
+			depth = int(value)
+		case "MAXVAL":
+			max = int(value)
+		default:
+			return t.errorf(ErrBadHeader, -1, -1, "invalid header keyword: %s", keyword)
+		}
+	}
+
+	if width <= 0 || height <= 0 {
+		return t.errorf(ErrBadHeader, -1, -1, "invalid dimensions: width and height must be positive")
+	}
+	if depth <= 0 {
+		return t.errorf(ErrBadHeader, -1, -1, "invalid depth: %d", depth)
+	}
+	if max <= 0 || max > 65535 {
+		return t.errorf(ErrBadHeader, -1, -1, "invalid max value: %d", max)
+	}
+
+	h.Width, h.Height, h.Depth, h.MaxValue = width, height, depth, uint(max)
+	h.TupleType = strings.Join(tupleTypes, " ")
+	return nil
+}
+
+// readPFMHeader lit les dimensions et le facteur d'échelle d'un en-tête PFM.
+func (t *tokenReader) readPFMHeader(h *Header) error {
+	var err error
+
+	// Lire les dimensions.
+	if h.Width, err = t.readUint("width"); err != nil {
+		return err
+	}
+	if h.Height, err = t.readUint("height"); err != nil {
+		return err
+	}
+	if h.Width <= 0 || h.Height <= 0 {
+		return t.errorf(ErrBadHeader, -1, -1, "invalid dimensions: width and height must be positive")
+	}
+	h.Depth = pfmChannels(h.MagicNumber)
+
+	// Lire le facteur d'échelle, dont le signe donne l'ordre des octets.
+	tok, err := t.token()
+	if err != nil {
+		return t.ioError(err, -1, -1, "scale")
+	}
+	h.Scale, err = strconv.ParseFloat(tok, 32)
+	if err != nil || h.Scale == 0 || math.IsNaN(h.Scale) || math.IsInf(h.Scale, 0) {
+		return t.errorf(ErrBadHeader, -1, -1, "invalid scale: %q", tok)
+	}
+
+	return t.readRasterSeparator()
+}
+
+// readRasterSeparator consomme l'unique blanc qui précède un raster binaire.
+// Comme dans libnetpbm, un commentaire peut suivre le dernier token de
+// l'en-tête : le saut de ligne qui le termine sert alors de blanc.
+func (t *tokenReader) readRasterSeparator() error {
+	c, err := t.readByte()
+	if err != nil {
+		return t.ioError(err, -1, -1, "header")
+	}
+	if c == '#' {
+		if err := t.skipComment(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return t.ioError(err, -1, -1, "header")
+		}
+		return nil
+	}
+	if !isSpace(c) {
+		// En mode tolérant, l'octet appartient au raster.
+		t.unreadByte()
+		return t.offSpec(ErrMissingSpace, -1, -1, "expected whitespace before raster, got %q", c)
+	}
+	return nil
+}
+
+// bytesPerSample retourne la taille d'un échantillon binaire : un octet jusqu'à
+// 255, deux octets big-endian au-delà.
+func bytesPerSample(max uint) int {
+	if max > 255 {
+		return 2
+	}
+	return 1
+}
+
+// getSample lit le i-ème échantillon de buf codé sur size octets.
+func getSample(buf []byte, i, size int) uint16 {
+	if size == 2 {
+		return uint16(buf[2*i])<<8 | uint16(buf[2*i+1])
+	}
+	return uint16(buf[i])
+}
+
+// putSample écrit le i-ème échantillon de buf sur size octets.
+func putSample(buf []byte, i, size int, value uint16) {
+	if size == 2 {
+		buf[2*i] = byte(value >> 8)
+		buf[2*i+1] = byte(value)
+		return
+	}
+	buf[i] = byte(value)
+}
+
+// swapRows inverse l'ordre des height lignes de stride éléments de pix.
+func swapRows[T any](pix []T, stride, height int) {
+	tmp := make([]T, stride)
+	for y := 0; y < height/2; y++ {
+		top, bottom := pix[y*stride:(y+1)*stride], pix[(height-1-y)*stride:(height-y)*stride]
+		copy(tmp, top)
+		copy(top, bottom)
+		copy(bottom, tmp)
+	}
+}
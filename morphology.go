@@ -0,0 +1,166 @@
+package Netpbm
+
+// StructuringElement est l'élément structurant des opérations morphologiques
+// sur les images PBM : l'ensemble des décalages, relatifs à son origine, de
+// ses pixels noirs.
+type StructuringElement struct {
+	offsets []Point
+}
+
+// NewStructuringElement crée un élément structurant à partir des pixels noirs
+// de kernel, origin désignant le pixel de kernel qui sert d'origine.
+func NewStructuringElement(kernel *PBM, origin Point) *StructuringElement {
+	se := &StructuringElement{}
+	for y := 0; y < kernel.height; y++ {
+		for x := 0; x < kernel.width; x++ {
+			if kernel.bit(x, y) {
+				se.offsets = append(se.offsets, Point{X: x - origin.X, Y: y - origin.Y})
+			}
+		}
+	}
+	return se
+}
+
+// KernelElement crée un élément structurant à partir des pixels noirs de
+// kernel, avec pour origine son pixel central.
+func KernelElement(kernel *PBM) *StructuringElement {
+	return NewStructuringElement(kernel, Point{X: kernel.width / 2, Y: kernel.height / 2})
+}
+
+// BoxElement crée un élément structurant rectangulaire de width×height pixels centré sur son origine.
+func BoxElement(width, height int) *StructuringElement {
+	kernel := newPBM(width, height, "P1")
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			kernel.putBit(x, y, true)
+		}
+	}
+	return KernelElement(kernel)
+}
+
+// CrossElement crée un élément structurant en forme de croix, dont les bras
+// s'étendent de radius pixels autour de l'origine.
+func CrossElement(radius int) *StructuringElement {
+	kernel := newPBM(2*radius+1, 2*radius+1, "P1")
+	for i := 0; i <= 2*radius; i++ {
+		kernel.putBit(i, radius, true)
+		kernel.putBit(radius, i, true)
+	}
+	return KernelElement(kernel)
+}
+
+// DiskElement crée un élément structurant en forme de disque de rayon radius.
+func DiskElement(radius int) *StructuringElement {
+	kernel := newPBM(2*radius+1, 2*radius+1, "P1")
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y <= radius*radius {
+				kernel.putBit(x+radius, y+radius, true)
+			}
+		}
+	}
+	return KernelElement(kernel)
+}
+
+// Erode ne garde noirs que les pixels dont tout le voisinage défini par se
+// est noir. Les pixels hors de l'image sont considérés comme blancs.
+func (pbm *PBM) Erode(se *StructuringElement) {
+	pbm.erode(se)
+	pbm.record("Erode")
+}
+
+// Dilate noircit chaque pixel dont le voisinage défini par se, réfléchi,
+// contient un pixel noir.
+func (pbm *PBM) Dilate(se *StructuringElement) {
+	pbm.dilate(se)
+	pbm.record("Dilate")
+}
+
+// Open applique une érosion puis une dilatation : les détails noirs plus
+// petits que se, comme les poussières d'un scan, disparaissent.
+func (pbm *PBM) Open(se *StructuringElement) {
+	pbm.erode(se)
+	pbm.dilate(se)
+	pbm.record("Open")
+}
+
+// Close applique une dilatation puis une érosion : les trous et coupures
+// blancs plus petits que se, comme un trait interrompu, sont comblés.
+func (pbm *PBM) Close(se *StructuringElement) {
+	pbm.dilate(se)
+	pbm.erode(se)
+	pbm.record("Close")
+}
+
+// HitOrMiss ne garde noirs que les pixels où hit tombe entièrement sur des
+// pixels noirs et miss entièrement sur des pixels blancs, ce qui détecte un
+// motif précis (coin, extrémité de trait, point isolé...).
+func (pbm *PBM) HitOrMiss(hit, miss *StructuringElement) {
+	// miss tombe entièrement sur du blanc là où la dilatation par miss
+	// réfléchi ne trouve aucun pixel noir ; contrairement à une érosion de
+	// l'image inversée, les pixels hors de l'image restent blancs.
+	background := pbm.clone()
+	background.dilate(miss.reflect())
+	background.Invert()
+
+	pbm.erode(hit)
+	pbm.combine(background, Point{}, func(a, b uint64) uint64 { return a & b })
+	pbm.record("HitOrMiss")
+}
+
+// reflect retourne l'élément structurant symétrique de se par rapport à son origine.
+func (se *StructuringElement) reflect() *StructuringElement {
+	r := &StructuringElement{offsets: make([]Point, len(se.offsets))}
+	for i, b := range se.offsets {
+		r.offsets[i] = Point{X: -b.X, Y: -b.Y}
+	}
+	return r
+}
+
+// erode calcule l'érosion mot par mot : l'intersection de l'image décalée de
+// chaque décalage de se.
+func (pbm *PBM) erode(se *StructuringElement) {
+	src := pbm.clone()
+	for i := range pbm.pix {
+		pbm.pix[i] = ^uint64(0)
+	}
+	for _, b := range se.offsets {
+		pbm.applyShifted(src, -b.X, -b.Y, func(a, b uint64) uint64 { return a & b })
+	}
+	pbm.clearPadding()
+}
+
+// dilate calcule la dilatation mot par mot : l'union de l'image décalée de
+// chaque décalage de se.
+func (pbm *PBM) dilate(se *StructuringElement) {
+	src := pbm.clone()
+	clear(pbm.pix)
+	for _, b := range se.offsets {
+		pbm.applyShifted(src, b.X, b.Y, func(a, b uint64) uint64 { return a | b })
+	}
+	pbm.clearPadding()
+}
+
+// applyShifted combine chaque pixel (x, y) de l'image avec le pixel
+// (x-dx, y-dy) de src par op, mot par mot ; les pixels hors de src sont
+// blancs. Les bits de remplissage doivent être remis à zéro ensuite.
+func (pbm *PBM) applyShifted(src *PBM, dx, dy int, op func(a, b uint64) uint64) {
+	for y := 0; y < pbm.height; y++ {
+		row := pbm.row(y)
+		var srcRow []uint64
+		if sy := y - dy; sy >= 0 && sy < src.height {
+			srcRow = src.row(sy)
+		}
+		for j := range row {
+			row[j] = op(row[j], wordAt(srcRow, 64*j-dx))
+		}
+	}
+}
+
+// clone retourne une copie de l'image.
+func (pbm *PBM) clone() *PBM {
+	c := *pbm
+	c.pix = append([]uint64(nil), pbm.pix...)
+	c.comments = append([]string(nil), pbm.comments...)
+	return &c
+}
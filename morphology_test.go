@@ -0,0 +1,162 @@
+package Netpbm
+
+import "testing"
+
+// shiftElement crée un élément structurant d'un seul pixel décalé de (dx, dy) par rapport à l'origine.
+func shiftElement(dx, dy int) *StructuringElement {
+	return NewStructuringElement(blackKernel(1, 1), Point{X: -dx, Y: -dy})
+}
+
+// blackKernel crée un noyau entièrement noir de width×height pixels.
+func blackKernel(width, height int) *PBM {
+	kernel := newPBM(width, height, "P1")
+	kernel.Invert()
+	return kernel
+}
+
+// testElements couvre des décalages dans les deux sens, dont certains
+// franchissent une limite de mot.
+func testElements() map[string]*StructuringElement {
+	return map[string]*StructuringElement{
+		"box 3x3":   BoxElement(3, 3),
+		"box 4x2":   BoxElement(4, 2),
+		"cross 1":   CrossElement(1),
+		"disk 2":    DiskElement(2),
+		"shift +1":  shiftElement(1, 0),
+		"shift -1":  shiftElement(-1, 1),
+		"shift +63": shiftElement(63, 0),
+		"shift -64": shiftElement(-64, -1),
+		"shift +65": shiftElement(65, 2),
+		"shift -70": shiftElement(-70, 0),
+	}
+}
+
+// referenceErode calcule l'érosion pixel par pixel, les pixels hors de l'image étant blancs.
+func referenceErode(src *PBM, se *StructuringElement) *PBM {
+	dst := newPBM(src.width, src.height, "P1")
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			black := true
+			for _, b := range se.offsets {
+				black = black && src.BitAt(x+b.X, y+b.Y)
+			}
+			dst.putBit(x, y, black)
+		}
+	}
+	return dst
+}
+
+// referenceDilate calcule la dilatation pixel par pixel.
+func referenceDilate(src *PBM, se *StructuringElement) *PBM {
+	dst := newPBM(src.width, src.height, "P1")
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			black := false
+			for _, b := range se.offsets {
+				black = black || src.BitAt(x-b.X, y-b.Y)
+			}
+			dst.putBit(x, y, black)
+		}
+	}
+	return dst
+}
+
+// checkSamePixels vérifie que got et want ont les mêmes pixels.
+func checkSamePixels(t *testing.T, name string, got, want *PBM) {
+	t.Helper()
+	checkPadding(t, got)
+	for y := 0; y < want.height; y++ {
+		for x := 0; x < want.width; x++ {
+			if got.bit(x, y) != want.bit(x, y) {
+				t.Fatalf("%s: pixel (%d, %d) is %v, want %v", name, x, y, got.bit(x, y), want.bit(x, y))
+			}
+		}
+	}
+}
+
+func TestErodeDilate(t *testing.T) {
+	for _, width := range testWidths {
+		for name, se := range testElements() {
+			src := randomPBM(width, 7, int64(width))
+
+			eroded := src.clone()
+			eroded.Erode(se)
+			checkSamePixels(t, "erode "+name, eroded, referenceErode(src, se))
+
+			dilated := src.clone()
+			dilated.Dilate(se)
+			checkSamePixels(t, "dilate "+name, dilated, referenceDilate(src, se))
+		}
+	}
+}
+
+func TestErodeDilateIdentity(t *testing.T) {
+	unit := BoxElement(1, 1)
+	for _, width := range testWidths {
+		src := randomPBM(width, 5, int64(width))
+
+		eroded := src.clone()
+		eroded.Erode(unit)
+		checkSamePixels(t, "erode by origin", eroded, src)
+
+		dilated := src.clone()
+		dilated.Dilate(unit)
+		checkSamePixels(t, "dilate by origin", dilated, src)
+
+		// Décaler l'image vers la droite puis la ramener ne perd que les
+		// colonnes sorties de l'image.
+		shifted := src.clone()
+		shifted.Dilate(shiftElement(3, 0))
+		shifted.Erode(shiftElement(3, 0))
+		for y := 0; y < src.height; y++ {
+			for x := 0; x < width-3; x++ {
+				if shifted.bit(x, y) != src.bit(x, y) {
+					t.Fatalf("width %d: shift and back changed pixel (%d, %d)", width, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenCloseIdempotent(t *testing.T) {
+	se := BoxElement(3, 3)
+	for _, width := range testWidths {
+		opened := randomPBM(width, 9, int64(width))
+		opened.Open(se)
+		again := opened.clone()
+		again.Open(se)
+		checkSamePixels(t, "open twice", again, opened)
+
+		closed := randomPBM(width, 9, int64(width))
+		closed.Close(se)
+		again = closed.clone()
+		again.Close(se)
+		checkSamePixels(t, "close twice", again, closed)
+	}
+}
+
+func TestHitOrMiss(t *testing.T) {
+	// Détecter les pixels noirs isolés : le centre noir, ses 8 voisins blancs.
+	hit := BoxElement(1, 1)
+	ring := blackKernel(3, 3)
+	ring.putBit(1, 1, false)
+	miss := KernelElement(ring)
+
+	for _, width := range testWidths {
+		src := randomPBM(width, 6, int64(width))
+		want := newPBM(width, src.height, "P1")
+		for y := 0; y < src.height; y++ {
+			for x := 0; x < width; x++ {
+				isolated := src.bit(x, y)
+				for _, b := range miss.offsets {
+					isolated = isolated && !src.BitAt(x+b.X, y+b.Y)
+				}
+				want.putBit(x, y, isolated)
+			}
+		}
+
+		got := src.clone()
+		got.HitOrMiss(hit, miss)
+		checkSamePixels(t, "hit-or-miss", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package Netpbm
+
+import (
+	"image"
+	"io"
+	"os"
+)
+
+// Image est l'interface commune aux images PBM, PGM, PPM, PAM et PFM :
+// dimensions, format, enregistrement et opérations géométriques.
+type Image interface {
+	image.Image
+
+	// Size retourne la largeur puis la hauteur de l'image.
+	Size() (int, int)
+	// MagicNumber retourne le format de l'image ("P1" à "P7", "PF" ou "Pf").
+	MagicNumber() string
+	// SetMagicNumber change le format utilisé par Save et Encode ; un magic
+	// number qui ne correspond pas au type de l'image est ignoré.
+	SetMagicNumber(magicNumber string)
+
+	// Save enregistre l'image de manière atomique : le fichier n'est remplacé
+	// qu'une fois l'image entièrement écrite.
+	Save(filename string) error
+	Encode(w io.Writer) error
+
+	// Invert inverse les valeurs de chaque pixel par rapport à la valeur maximale.
+	Invert()
+	// Flip retourne l'image horizontalement.
+	Flip()
+	// Flop retourne l'image verticalement.
+	Flop()
+	// Rotate90CW fait pivoter l'image de 90 degrés dans le sens des aiguilles d'une montre.
+	Rotate90CW()
+}
+
+// ReadAny lit un fichier Netpbm de n'importe quel format reconnu par son magic number.
+func ReadAny(filename string) (Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return DecodeAny(file)
+}
+
+// DecodeAny lit le magic number en tête de r et décode l'image avec le lecteur
+// correspondant : *PBM, *PGM, *PPM, *PAM ou *PFM.
+func DecodeAny(r io.Reader) (Image, error) {
+	return decodeAny(newTokenReader(r, nil))
+}
+
+// decodeAny choisit le décodeur d'après le magic number, sans le consommer.
+func decodeAny(t *tokenReader) (Image, error) {
+	magic, err := t.r.Peek(2)
+	if err != nil {
+		return nil, t.ioError(err, -1, -1, "magic number")
+	}
+
+	switch string(magic) {
+	case "P1", "P4":
+		return decodeAs(decodePBM(t))
+	case "P2", "P5":
+		return decodeAs(decodePGM(t))
+	case "P3", "P6":
+		return decodeAs(decodePPM(t))
+	case "P7":
+		return decodeAs(decodePAM(t))
+	case "PF", "Pf":
+		return decodeAs(decodePFM(t))
+	}
+	return nil, t.errorf(ErrInvalidMagic, -1, -1, "invalid magic number: %q", magic)
+}
+
+// decodeAs convertit le résultat d'un décodeur en Image, sans retourner de pointeur nil typé en cas d'erreur.
+func decodeAs[T Image](img T, err error) (Image, error) {
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,223 @@
+package Netpbm
+
+import (
+	"io"
+	"os"
+)
+
+// DecodeOptions règle le décodage : limites de ressources, pour lire sans
+// risque des fichiers Netpbm de provenance inconnue, et tolérance aux écarts
+// à la spécification. Une limite à zéro est désactivée ; un *DecodeOptions
+// nil, comme la valeur zéro, n'impose aucune limite.
+//
+// Les dimensions sont vérifiées dès la lecture de l'en-tête, avant toute
+// allocation du raster ; un dépassement retourne une DecodeError de
+// catégorie ErrTooLarge.
+//
+// Mode choisit la réaction aux écarts à la spécification ; voir DecodeMode.
+type DecodeOptions struct {
+	MaxWidth  int // largeur maximale en pixels
+	MaxHeight int // hauteur maximale en pixels
+	// MaxPixels est le nombre maximal de pixels (largeur × hauteur). Pour
+	// PAM, dont la profondeur n'est pas bornée, chaque échantillon d'un tuple
+	// compte pour un pixel (largeur × hauteur × profondeur).
+	MaxPixels int64
+	// MaxBytes est le nombre maximal d'octets lus pour une image, en-tête
+	// compris. Un en-tête qui annonce un raster plus grand est refusé avant
+	// sa lecture ; avec un Reader, la limite s'applique à chaque image.
+	MaxBytes int64
+
+	Mode DecodeMode
+	// Warn reçoit, en mode tolérant, une *DecodeError pour chaque écart corrigé.
+	Warn func(err error)
+}
+
+// DecodeMode choisit la réaction du décodeur aux écarts à la spécification :
+// échantillon supérieur à la valeur maximale, raster incomplet, blanc
+// manquant après le magic number ou l'en-tête, chiffres P1 non séparés,
+// données après le raster.
+type DecodeMode int
+
+const (
+	// DecodeDefault refuse tout écart dans l'image, sans lire les données
+	// qui suivent le raster. C'est le mode d'un *DecodeOptions nil.
+	DecodeDefault DecodeMode = iota
+	// DecodeStrict refuse tout écart, y compris des données après le raster.
+	DecodeStrict
+	// DecodeLenient corrige les écarts et les signale à Warn : échantillon
+	// ramené à la valeur maximale ou à zéro s'il est invalide, lignes
+	// manquantes complétées par des zéros, chiffres P1 accolés acceptés,
+	// données finales ignorées.
+	DecodeLenient
+)
+
+// DecodePBM lit une image PBM depuis r en respectant les limites de o.
+func (o *DecodeOptions) DecodePBM(r io.Reader) (*PBM, error) {
+	return decodeOne(newTokenReader(r, o), decodePBM)
+}
+
+// DecodePGM lit une image PGM depuis r en respectant les limites de o.
+func (o *DecodeOptions) DecodePGM(r io.Reader) (*PGM, error) {
+	return decodeOne(newTokenReader(r, o), decodePGM)
+}
+
+// DecodePPM lit une image PPM depuis r en respectant les limites de o.
+func (o *DecodeOptions) DecodePPM(r io.Reader) (*PPM, error) {
+	return decodeOne(newTokenReader(r, o), decodePPM)
+}
+
+// DecodePAM lit une image PAM depuis r en respectant les limites de o.
+func (o *DecodeOptions) DecodePAM(r io.Reader) (*PAM, error) {
+	return decodeOne(newTokenReader(r, o), decodePAM)
+}
+
+// DecodePFM lit une image PFM depuis r en respectant les limites de o.
+func (o *DecodeOptions) DecodePFM(r io.Reader) (*PFM, error) {
+	return decodeOne(newTokenReader(r, o), decodePFM)
+}
+
+// DecodeAny lit une image de n'importe quel format depuis r en respectant les limites de o.
+func (o *DecodeOptions) DecodeAny(r io.Reader) (Image, error) {
+	return decodeOne(newTokenReader(r, o), decodeAny)
+}
+
+// ReadAny lit un fichier Netpbm de n'importe quel format en respectant les limites de o.
+func (o *DecodeOptions) ReadAny(filename string) (Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return o.DecodeAny(file)
+}
+
+// NewReader crée un Reader dont chaque image respecte les limites de o.
+func (o *DecodeOptions) NewReader(r io.Reader) *Reader {
+	return &Reader{t: newTokenReader(r, o)}
+}
+
+// NewRowReader crée un RowReader dont l'image respecte les limites de o.
+func (o *DecodeOptions) NewRowReader(r io.Reader) (*RowReader, error) {
+	return newRowReaderFrom(newTokenReader(r, o))
+}
+
+// decodeOne décode une image unique depuis t puis vérifie que rien d'autre
+// que des blancs ne la suit.
+func decodeOne[T any](t *tokenReader, decode func(*tokenReader) (T, error)) (T, error) {
+	img, err := decode(t)
+	if err == nil {
+		err = t.checkTrailing()
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return img, nil
+}
+
+// checkTrailing vérifie, en mode strict ou tolérant, qu'il ne reste que des
+// blancs après le raster. Sinon, il n'y a rien à signaler et le flux n'est
+// pas lu.
+func (t *tokenReader) checkTrailing() error {
+	if !t.strict() && !t.lenient() {
+		return nil
+	}
+	for {
+		c, err := t.readByte()
+		if err == ErrTooLarge && t.atEOF() {
+			// Le fichier se termine exactement à la limite MaxBytes.
+			err = io.EOF
+		}
+		if err == io.EOF || (err != nil && t.lenient()) {
+			return nil
+		}
+		if err != nil {
+			return t.ioError(err, -1, -1, "trailing data")
+		}
+		if !isSpace(c) {
+			return t.offSpec(ErrTrailingData, -1, -1, "unexpected data %q after raster", c)
+		}
+	}
+}
+
+// strict indique si le décodage se fait en mode DecodeStrict.
+func (t *tokenReader) strict() bool {
+	return t.opts != nil && t.opts.Mode == DecodeStrict
+}
+
+// lenient indique si le décodage se fait en mode DecodeLenient.
+func (t *tokenReader) lenient() bool {
+	return t.opts != nil && t.opts.Mode == DecodeLenient
+}
+
+// offSpec signale un écart à la spécification : hors du mode tolérant, il
+// retourne la DecodeError correspondante ; en mode tolérant, il la transmet
+// à Warn et retourne nil pour que le décodeur corrige l'écart et continue.
+func (t *tokenReader) offSpec(kind error, row, column int, format string, args ...any) error {
+	err := t.errorf(kind, row, column, format, args...)
+	if !t.lenient() {
+		return err
+	}
+	if t.opts.Warn != nil {
+		t.opts.Warn(err)
+	}
+	return nil
+}
+
+// checkLimits vérifie l'en-tête h par rapport aux limites de o, avant que
+// le raster ne soit alloué ou lu.
+func (t *tokenReader) checkLimits(h *Header) error {
+	o := t.opts
+	if o == nil {
+		return nil
+	}
+	if o.MaxWidth > 0 && h.Width > o.MaxWidth {
+		return t.errorf(ErrTooLarge, -1, -1, "width %d exceeds limit %d", h.Width, o.MaxWidth)
+	}
+	if o.MaxHeight > 0 && h.Height > o.MaxHeight {
+		return t.errorf(ErrTooLarge, -1, -1, "height %d exceeds limit %d", h.Height, o.MaxHeight)
+	}
+	// Width et Height tiennent sur 31 bits : leur produit ne déborde pas d'un int64.
+	pixels := int64(h.Width) * int64(h.Height)
+	if o.MaxPixels > 0 && pixels > o.MaxPixels {
+		return t.errorf(ErrTooLarge, -1, -1, "%d pixels exceed limit %d", pixels, o.MaxPixels)
+	}
+	// Comparer par division pour que pixels × profondeur ne déborde pas.
+	if o.MaxPixels > 0 && h.MagicNumber == "P7" && pixels > o.MaxPixels/int64(h.Depth) {
+		return t.errorf(ErrTooLarge, -1, -1, "%d pixels of depth %d exceed limit %d", pixels, h.Depth, o.MaxPixels)
+	}
+	if o.MaxBytes > 0 {
+		if size := h.minRasterSize(); size > o.MaxBytes-(t.off-t.start) {
+			return t.errorf(ErrTooLarge, -1, -1, "raster of at least %d bytes exceeds limit %d", size, o.MaxBytes)
+		}
+	}
+	return nil
+}
+
+// minRasterSize retourne le nombre minimal d'octets du raster décrit par h :
+// sa taille exacte pour les formats binaires, un octet par échantillon pour
+// les formats ASCII. Le résultat est plafonné pour ne pas déborder.
+func (h *Header) minRasterSize() int64 {
+	const limit = 1 << 62
+	size := int64(1)
+	switch h.MagicNumber {
+	case "P5", "P6", "P7":
+		size = int64(bytesPerSample(h.MaxValue))
+	case "PF", "Pf":
+		size = 4
+	}
+	// Width et Depth tiennent sur 31 bits : rowSize tient sur 64 bits.
+	rowSize := int64(h.Width) * int64(h.Depth)
+	if h.MagicNumber == "P4" {
+		rowSize = (int64(h.Width) + 7) / 8
+	}
+	if rowSize > limit/size {
+		return limit
+	}
+	rowSize *= size
+	if rowSize > 0 && int64(h.Height) > limit/rowSize {
+		return limit
+	}
+	return rowSize * int64(h.Height)
+}
@@ -0,0 +1,74 @@
+package Netpbm
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHostilePAMDepth(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		opts   DecodeOptions
+	}{
+		{"max depth", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 2147483647\nMAXVAL 255\nENDHDR\n", DecodeOptions{MaxPixels: 100}},
+		{"large depth", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 200000000\nMAXVAL 255\nENDHDR\n", DecodeOptions{MaxPixels: 100}},
+		{"wide and deep", "P7\nWIDTH 10\nHEIGHT 10\nDEPTH 2\nMAXVAL 255\nENDHDR\n", DecodeOptions{MaxWidth: 10, MaxHeight: 10, MaxPixels: 100}},
+	}
+	for _, tt := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := tt.opts.DecodePAM(strings.NewReader(tt.header))
+		runtime.ReadMemStats(&after)
+
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: got error %v, want ErrTooLarge", tt.name, err)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%s: %d bytes allocated before the limit was enforced", tt.name, allocated)
+		}
+	}
+}
+
+func TestPAMDepthWithinLimit(t *testing.T) {
+	opts := DecodeOptions{MaxPixels: 8}
+	pam, err := opts.DecodePAM(strings.NewReader("P7\nWIDTH 2\nHEIGHT 1\nDEPTH 4\nMAXVAL 255\nENDHDR\nabcdefgh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pam.Depth() != 4 {
+		t.Errorf("depth %d, want 4", pam.Depth())
+	}
+}
+
+func TestDecodeModes(t *testing.T) {
+	tests := []struct {
+		input   string
+		mode    DecodeMode
+		want    error // nil si l'image doit être décodée
+		warning bool  // un écart doit être signalé à Warn
+	}{
+		{"P5 2 1 255\nab", DecodeDefault, nil, false},
+		{"P5 2 1 255\nab junk", DecodeDefault, nil, false},
+		{"P5 2 1 255\nab junk", DecodeStrict, ErrTrailingData, false},
+		{"P5 2 1 255\nab junk", DecodeLenient, nil, true},
+		{"P5 2 2 255\nab", DecodeDefault, ErrTruncated, false},
+		{"P5 2 2 255\nab", DecodeStrict, ErrTruncated, false},
+		{"P5 2 2 255\nab", DecodeLenient, nil, true},
+		{"P2 1 1 5\n9", DecodeDefault, ErrSampleOutOfRange, false},
+		{"P2 1 1 5\n9", DecodeLenient, nil, true},
+	}
+	for _, tt := range tests {
+		warned := false
+		opts := DecodeOptions{Mode: tt.mode, Warn: func(error) { warned = true }}
+		_, err := opts.DecodePGM(strings.NewReader(tt.input))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q in mode %d: got error %v, want %v", tt.input, tt.mode, err, tt.want)
+		}
+		if warned != tt.warning {
+			t.Errorf("%q in mode %d: warned %v, want %v", tt.input, tt.mode, warned, tt.warning)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package Netpbm
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+)
+
+// Types de tuples définis par la spécification PAM.
+const (
+	TupleTypeBlackAndWhite      = "BLACKANDWHITE"
+	TupleTypeGrayscale          = "GRAYSCALE"
+	TupleTypeRGB                = "RGB"
+	TupleTypeBlackAndWhiteAlpha = "BLACKANDWHITE_ALPHA"
+	TupleTypeGrayscaleAlpha     = "GRAYSCALE_ALPHA"
+	TupleTypeRGBAlpha           = "RGB_ALPHA"
+)
+
+// PAM représente une image PAM (P7) : chaque pixel est un tuple de depth échantillons.
+type PAM struct {
+	data          [][]uint16 // une ligne contient width*depth échantillons entrelacés
+	width, height int
+	depth         int
+	magicNumber   string
+	max           uint
+	tupleType     string
+	annotations
+}
+
+// NewPAM crée une image PAM vide avec les dimensions, la profondeur, la valeur maximale et le type de tuple donnés.
+func NewPAM(width, height, depth int, max uint, tupleType string) *PAM {
+	pam := &PAM{
+		data:        make([][]uint16, height),
+		width:       width,
+		height:      height,
+		depth:       depth,
+		magicNumber: "P7",
+		max:         max,
+		tupleType:   tupleType,
+	}
+	for y := range pam.data {
+		pam.data[y] = make([]uint16, width*depth)
+	}
+	return pam
+}
+
+// ReadPAM lit une image PAM depuis un fichier.
+func ReadPAM(filename string) (*PAM, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return DecodePAM(file)
+}
+
+// DecodePAM lit une image PAM (P7) depuis r.
+func DecodePAM(r io.Reader) (*PAM, error) {
+	return decodePAM(newTokenReader(r, nil))
+}
+
+// decodePAM décode une image PAM depuis t, sans lire au-delà de son raster.
+func decodePAM(t *tokenReader) (*PAM, error) {
+	// Lire l'en-tête : WIDTH, HEIGHT, DEPTH, MAXVAL et TUPLTYPE.
+	h, err := t.readHeader("P7")
+	if err != nil {
+		return nil, err
+	}
+	pam := NewPAM(h.Width, h.Height, h.Depth, h.MaxValue, h.TupleType)
+	pam.comments = h.Comments
+
+	// Lire le raster binaire, ligne par ligne.
+	rows := newRowReader(t, h)
+	for y := range pam.data {
+		if err := rows.ReadRow(pam.data[y]); err != nil {
+			return nil, err
+		}
+	}
+
+	return pam, nil
+}
+
+// Size retourne la largeur et la hauteur de l'image PAM.
+func (pam *PAM) Size() (int, int) {
+	return pam.width, pam.height
+}
+
+// MagicNumber retourne le numéro magique de l'image PAM, toujours "P7".
+func (pam *PAM) MagicNumber() string {
+	return pam.magicNumber
+}
+
+// SetMagicNumber ne fait rien : le format PAM n'a qu'un seul magic number, "P7".
+func (pam *PAM) SetMagicNumber(magicNumber string) {}
+
+// Depth retourne le nombre d'échantillons par tuple.
+func (pam *PAM) Depth() int {
+	return pam.depth
+}
+
+// TupleType retourne le type de tuple de l'image PAM.
+func (pam *PAM) TupleType() string {
+	return pam.tupleType
+}
+
+// HasAlpha indique si le dernier échantillon de chaque tuple est un canal alpha.
+func (pam *PAM) HasAlpha() bool {
+	return strings.HasSuffix(pam.tupleType, "_ALPHA")
+}
+
+// Tuple retourne une copie du tuple à la position (x, y).
+func (pam *PAM) Tuple(x, y int) []uint16 {
+	if x < 0 || x >= pam.width || y < 0 || y >= pam.height {
+		return nil
+	}
+	tuple := make([]uint16, pam.depth)
+	copy(tuple, pam.data[y][x*pam.depth:(x+1)*pam.depth])
+	return tuple
+}
+
+// SetTuple définit le tuple à la position (x, y), chaque échantillon étant ramené à la valeur maximale s'il la dépasse.
+func (pam *PAM) SetTuple(x, y int, tuple []uint16) {
+	if x >= 0 && x < pam.width && y >= 0 && y < pam.height {
+		dst := pam.data[y][x*pam.depth : (x+1)*pam.depth]
+		for i := 0; i < len(dst) && i < len(tuple); i++ {
+			dst[i] = min(tuple[i], uint16(pam.max))
+		}
+	}
+}
+
+// ColorModel retourne color.NRGBA64Model, l'alpha PAM n'étant pas prémultiplié (image.Image).
+func (pam *PAM) ColorModel() color.Model {
+	return color.NRGBA64Model
+}
+
+// Bounds retourne le rectangle couvert par l'image PAM (image.Image).
+func (pam *PAM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, pam.width, pam.height)
+}
+
+// At retourne la couleur du tuple en (x, y), ramenée à la pleine échelle 16 bits (image.Image).
+func (pam *PAM) At(x, y int) color.Color {
+	if x < 0 || x >= pam.width || y < 0 || y >= pam.height {
+		return color.NRGBA64{}
+	}
+
+	tuple := pam.data[y][x*pam.depth : (x+1)*pam.depth]
+	colors := pam.colorChannels()
+	c := color.NRGBA64{A: 65535}
+	if colors == 3 {
+		c.R = scaleSample(tuple[0], pam.max, 65535)
+		c.G = scaleSample(tuple[1], pam.max, 65535)
+		c.B = scaleSample(tuple[2], pam.max, 65535)
+	} else {
+		c.R = scaleSample(tuple[0], pam.max, 65535)
+		c.G, c.B = c.R, c.R
+	}
+	if pam.HasAlpha() && pam.depth > colors {
+		c.A = scaleSample(tuple[colors], pam.max, 65535)
+	}
+	return c
+}
+
+// Set définit le tuple en (x, y) à partir de n'importe quelle couleur (draw.Image).
+func (pam *PAM) Set(x, y int, c color.Color) {
+	if x < 0 || x >= pam.width || y < 0 || y >= pam.height {
+		return
+	}
+
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	tuple := pam.data[y][x*pam.depth : (x+1)*pam.depth]
+	colors := pam.colorChannels()
+	if colors == 3 {
+		tuple[0] = scaleSample(n.R, 65535, pam.max)
+		tuple[1] = scaleSample(n.G, 65535, pam.max)
+		tuple[2] = scaleSample(n.B, 65535, pam.max)
+	} else {
+		gray := color.Gray16Model.Convert(color.NRGBA64{R: n.R, G: n.G, B: n.B, A: 65535}).(color.Gray16)
+		tuple[0] = scaleSample(gray.Y, 65535, pam.max)
+	}
+	if pam.HasAlpha() && pam.depth > colors {
+		tuple[colors] = scaleSample(n.A, 65535, pam.max)
+	}
+}
+
+// SetTupleType définit le type de tuple de l'image PAM.
+func (pam *PAM) SetTupleType(tupleType string) {
+	pam.tupleType = tupleType
+}
+
+// Save enregistre l'image PAM dans un fichier.
+func (pam *PAM) Save(filename string) error {
+	return saveFile(filename, pam.Encode)
+}
+
+// Encode écrit l'image PAM dans w.
+func (pam *PAM) Encode(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+
+	// Écrire l'en-tête et ses commentaires.
+	h := Header{MagicNumber: "P7", Width: pam.width, Height: pam.height, Depth: pam.depth, MaxValue: pam.max, TupleType: pam.tupleType, Comments: pam.comments}
+	err := writeHeader(writer, &h)
+	if err != nil {
+		return err
+	}
+
+	// Écrire le raster binaire.
+	size := bytesPerSample(pam.max)
+	row := make([]byte, pam.width*pam.depth*size)
+	for y := 0; y < pam.height; y++ {
+		for i, sample := range pam.data[y] {
+			putSample(row, i, size, sample)
+		}
+		_, err = writer.Write(row)
+		if err != nil {
+			return fmt.Errorf("error writing pixel data at row %d: %v", y, err)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Invert inverse les échantillons de couleur de l'image PAM, le canal alpha étant conservé.
+func (pam *PAM) Invert() {
+	colors := pam.depth
+	if pam.HasAlpha() {
+		colors--
+	}
+	for y := range pam.data {
+		for x := 0; x < pam.width; x++ {
+			for c := 0; c < colors; c++ {
+				i := x*pam.depth + c
+				// Un échantillon au-delà de max donne 0 au lieu de boucler.
+				pam.data[y][i] = uint16(pam.max) - min(pam.data[y][i], uint16(pam.max))
+			}
+		}
+	}
+	pam.record("Invert")
+}
+
+// Flip retourne l'image PAM horizontalement.
+func (pam *PAM) Flip() {
+	for y := range pam.data {
+		flipTuples(pam.data[y], pam.depth)
+	}
+	pam.record("Flip")
+}
+
+// Flop retourne l'image PAM verticalement.
+func (pam *PAM) Flop() {
+	for i := 0; i < pam.height/2; i++ {
+		pam.data[i], pam.data[pam.height-i-1] = pam.data[pam.height-i-1], pam.data[i]
+	}
+	pam.record("Flop")
+}
+
+// Rotate90CW fait pivoter l'image PAM de 90 degrés dans le sens des aiguilles d'une montre.
+func (pam *PAM) Rotate90CW() {
+	pam.data = rotateTuples(pam.data, pam.width, pam.height, pam.depth)
+	pam.width, pam.height = pam.height, pam.width
+	pam.record("Rotate90CW")
+}
+
+// flipTuples inverse l'ordre des tuples de depth échantillons dans row.
+func flipTuples[T any](row []T, depth int) {
+	width := len(row) / depth
+	for i, j := 0, width-1; i < j; i, j = i+1, j-1 {
+		for c := 0; c < depth; c++ {
+			row[i*depth+c], row[j*depth+c] = row[j*depth+c], row[i*depth+c]
+		}
+	}
+}
+
+// rotateTuples retourne les lignes de data pivotées de 90 degrés dans le sens des aiguilles d'une montre.
+func rotateTuples[T any](data [][]T, width, height, depth int) [][]T {
+	newData := make([][]T, width)
+	for i := range newData {
+		newData[i] = make([]T, height*depth)
+		for j := 0; j < height; j++ {
+			copy(newData[i][j*depth:(j+1)*depth], data[height-j-1][i*depth:(i+1)*depth])
+		}
+	}
+	return newData
+}
+
+// AddAlpha ajoute un canal alpha opaque aux images GRAYSCALE, RGB et
+// BLACKANDWHITE. Une image sans type de tuple reste inchangée : rien ne
+// permettrait ensuite de reconnaître le canal ajouté comme un alpha.
+func (pam *PAM) AddAlpha() {
+	if pam.HasAlpha() || pam.tupleType == "" {
+		return
+	}
+	depth := pam.depth + 1
+	for y := range pam.data {
+		row := make([]uint16, pam.width*depth)
+		for x := 0; x < pam.width; x++ {
+			copy(row[x*depth:], pam.data[y][x*pam.depth:(x+1)*pam.depth])
+			row[x*depth+pam.depth] = uint16(pam.max)
+		}
+		pam.data[y] = row
+	}
+	pam.depth = depth
+	pam.tupleType += "_ALPHA"
+	pam.record("AddAlpha")
+}
+
+// ToPGM convertit l'image PAM en une image PGM, en faisant la moyenne des composantes couleur et en ignorant l'alpha.
+func (pam *PAM) ToPGM() *PGM {
+	pgm := newPGM(pam.width, pam.height, "P2", pam.max)
+	pgm.annotations = pam.derive("ToPGM")
+
+	colors := pam.colorChannels()
+	for y := 0; y < pam.height; y++ {
+		for x := 0; x < pam.width; x++ {
+			tuple := pam.data[y][x*pam.depth : (x+1)*pam.depth]
+			if colors == 3 {
+				pgm.putValue(x, y, uint16((int(tuple[0])+int(tuple[1])+int(tuple[2]))/3))
+			} else {
+				pgm.putValue(x, y, tuple[0])
+			}
+		}
+	}
+
+	return pgm
+}
+
+// ToPPM convertit l'image PAM en une image PPM, en dupliquant les niveaux de gris et en ignorant l'alpha.
+func (pam *PAM) ToPPM() *PPM {
+	ppm := newPPM(pam.width, pam.height, "P3", pam.max)
+	ppm.annotations = pam.derive("ToPPM")
+
+	colors := pam.colorChannels()
+	for y := 0; y < pam.height; y++ {
+		for x := 0; x < pam.width; x++ {
+			tuple := pam.data[y][x*pam.depth : (x+1)*pam.depth]
+			if colors == 3 {
+				ppm.putPixel(x, y, Pixel{R: tuple[0], G: tuple[1], B: tuple[2]})
+			} else {
+				ppm.putPixel(x, y, Pixel{R: tuple[0], G: tuple[0], B: tuple[0]})
+			}
+		}
+	}
+
+	return ppm
+}
+
+// ToPBM convertit l'image PAM en une image PBM : les pixels plus sombres que la moitié de la valeur maximale deviennent noirs.
+func (pam *PAM) ToPBM() *PBM {
+	pgm := pam.ToPGM()
+	pbm := newPBM(pam.width, pam.height, "P1")
+	pbm.annotations = pam.derive("ToPBM")
+
+	for y := 0; y < pam.height; y++ {
+		for x := 0; x < pam.width; x++ {
+			pbm.putBit(x, y, 2*uint(pgm.value(x, y)) < pam.max)
+		}
+	}
+
+	return pbm
+}
+
+// colorChannels retourne le nombre d'échantillons de couleur d'un tuple : 3 pour RGB, 1 sinon.
+func (pam *PAM) colorChannels() int {
+	if strings.HasPrefix(pam.tupleType, TupleTypeRGB) && pam.depth >= 3 {
+		return 3
+	}
+	if pam.tupleType == "" && pam.depth >= 3 {
+		return 3
+	}
+	return 1
+}
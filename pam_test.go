@@ -0,0 +1,35 @@
+package Netpbm
+
+import "testing"
+
+func TestPAMSetTupleClamps(t *testing.T) {
+	pam := NewPAM(1, 1, 2, 255, TupleTypeGrayscaleAlpha)
+	pam.SetTuple(0, 0, []uint16{300, 100})
+	if got := pam.Tuple(0, 0); got[0] != 255 || got[1] != 100 {
+		t.Fatalf("SetTuple stored %v, want [255 100]", got)
+	}
+
+	// Un échantillon hors limite écrit directement sature à 0 au lieu de boucler.
+	pam.data[0][0] = 300
+	pam.Invert()
+	if got := pam.Tuple(0, 0); got[0] != 0 || got[1] != 100 {
+		t.Fatalf("Invert gave %v, want [0 100]", got)
+	}
+}
+
+func TestPAMAddAlpha(t *testing.T) {
+	pam := NewPAM(2, 1, 3, 255, TupleTypeRGB)
+	pam.AddAlpha()
+	if pam.Depth() != 4 || !pam.HasAlpha() || pam.TupleType() != TupleTypeRGBAlpha {
+		t.Fatalf("depth %d, tuple type %q after AddAlpha", pam.Depth(), pam.TupleType())
+	}
+	if got := pam.Tuple(1, 0); got[3] != 255 {
+		t.Errorf("alpha %d, want opaque 255", got[3])
+	}
+
+	untyped := NewPAM(2, 1, 3, 255, "")
+	untyped.AddAlpha()
+	if untyped.Depth() != 3 || untyped.HasAlpha() {
+		t.Errorf("AddAlpha changed an untyped image: depth %d, tuple type %q", untyped.Depth(), untyped.TupleType())
+	}
+}
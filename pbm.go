@@ -2,22 +2,31 @@ package Netpbm
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
 	"os"
-	"strconv"
-	"strings"
 )
 
 type PBM struct {
-	data          [][]bool
+	pix           []uint64 // pixels empaquetés par mots de 64 bits : 1 bit par pixel, 1 pour noir, le bit de poids fort en premier
+	stride        int      // mots par ligne de pix, ceil(width/64)
 	width, height int
 	magicNumber   string
+	annotations
+}
+
+// newPBM crée une image PBM blanche de width×height pixels.
+func newPBM(width, height int, magicNumber string) *PBM {
+	stride := (width + 63) / 64
+	return &PBM{pix: make([]uint64, stride*height), stride: stride, width: width, height: height, magicNumber: magicNumber}
 }
 
 // ReadPBM lie l'image PBM du fichier et return dans la struct avec les infos de l'image.
 func ReadPBM(filename string) (*PBM, error) {
-	pbm := PBM{}
-
 	// Ouvrir le fichier
 	file, err := os.Open(filename)
 	if err != nil {
@@ -25,199 +34,360 @@ func ReadPBM(filename string) (*PBM, error) {
 	}
 	defer file.Close()
 
-	// Scanner pour extraire les informations basées sur du texte.
-	scanner := bufio.NewScanner(file)
-	confirmOne := false
-	confirmTwo := false
-	Line := 0
+	return DecodePBM(file)
+}
 
-	// Ignorer les commentaires et les lignes vides.
-	for scanner.Scan() {
-		if scanner.Text() == "" {
-			continue
-		}
+// DecodePBM lit une image PBM (P1 ou P4) depuis r et retourne la struct avec les infos de l'image.
+func DecodePBM(r io.Reader) (*PBM, error) {
+	return decodePBM(newTokenReader(r, nil))
+}
 
-		if strings.HasPrefix(scanner.Text(), "#") {
-			continue
-		} else if !confirmOne {
-			// Lire le magic number qui indique le format du fichier PBM.
-			pbm.magicNumber = scanner.Text()
-			confirmOne = true
-		} else if !confirmTwo {
-			sepa := strings.Fields(scanner.Text())
-			if len(sepa) > 0 {
-				pbm.width, _ = strconv.Atoi(sepa[0])
-				pbm.height, _ = strconv.Atoi(sepa[1])
-			}
-			confirmTwo = true
+// decodePBM décode une image PBM depuis t, sans lire au-delà de son raster.
+func decodePBM(t *tokenReader) (*PBM, error) {
+	// Lire l'en-tête : magic number et dimensions.
+	h, err := t.readHeader("P1", "P4")
+	if err != nil {
+		return nil, err
+	}
+
+	pbm := newPBM(h.Width, h.Height, h.MagicNumber)
+	pbm.comments = h.Comments
 
-			pbm.data = make([][]bool, pbm.height)
-			for i := range pbm.data {
-				pbm.data[i] = make([]bool, pbm.width)
+	// Lire le raster ligne par ligne depuis le même flux : un token "0" ou "1"
+	// par pixel en P1, exactement ceil(width/8) octets par ligne en P4, dont
+	// les bits de remplissage en fin de ligne sont ignorés.
+	rows := newRowReader(t, h)
+	if pbm.magicNumber == "P4" {
+		// Les octets P4 se recopient tels quels dans les mots.
+		for y := 0; y < pbm.height; y++ {
+			if err := rows.readPackedRow(pbm.row(y)); err != nil {
+				return nil, err
 			}
+		}
+		pbm.clearPadding()
+		return pbm, nil
+	}
+	samples := make([]uint16, pbm.width)
+	for y := 0; y < pbm.height; y++ {
+		if err := rows.ReadRow(samples); err != nil {
+			return nil, err
+		}
+		for x, sample := range samples {
+			pbm.putBit(x, y, sample != 0)
+		}
+	}
 
-		} else {
-			if pbm.magicNumber == "P1" {
-				// Processus pour le format P1.
-				test := strings.Fields(scanner.Text())
-				for i := 0; i < pbm.width; i++ {
-					if test[i] == "1" {
-						pbm.data[Line][i] = true
-					} else {
-						pbm.data[Line][i] = false
-					}
-				}
-				Line++
-			} else if pbm.magicNumber == "P4" {
-				expectedBytesPerRow := (pbm.width + 7) / 8
-				totalExpectedBytes := expectedBytesPerRow * pbm.height
-				fmt.Printf("Expected total bytes for pixel data: %d\n", totalExpectedBytes)
+	return pbm, nil
+}
 
-				// Créer un tampon pour contenir toutes les données des pixels.
-				allPixelData := make([]byte, totalExpectedBytes)
+// Size retourne la largeur et la hauteur de l'image.
+func (pbm *PBM) Size() (int, int) {
+	return pbm.width, pbm.height
+}
 
-				// Lire le contenu du fichier directement dans le tampon.
-				fileContent, err := os.ReadFile(filename)
-				if err != nil {
-					return nil, fmt.Errorf("error reading file: %v", err)
-				}
+// MagicNumber retourne le numéro magique de l'image PBM.
+func (pbm *PBM) MagicNumber() string {
+	return pbm.magicNumber
+}
 
-				// Copier la partie pertinente du contenu du fichier dans le tampon des données des pixels.
-				copy(allPixelData, fileContent[len(fileContent)-totalExpectedBytes:])
-
-				// Processus pour mettre à jour pbm.data en utilisant le tampon des données des pixels.
-				byteIndex := 0
-				for y := 0; y < pbm.height; y++ {
-					for x := 0; x < pbm.width; x++ {
-						if x%8 == 0 && x != 0 {
-							byteIndex++
-						}
-						pbm.data[y][x] = (allPixelData[byteIndex]>>(7-(x%8)))&1 != 0
-					}
-					byteIndex++
-				}
+// Pix retourne le raster de l'image, partagé avec elle : Height lignes de
+// Stride mots de 64 bits, un bit par pixel (1 pour noir), le pixel x occupant
+// le bit 63-x%64 du mot x/64. Écrits en big-endian, les mots d'une ligne
+// donnent la ligne P4. Les bits de remplissage en fin de ligne restent à zéro.
+func (pbm *PBM) Pix() []uint64 {
+	return pbm.pix
+}
 
-			}
-		}
+// Stride retourne le nombre de mots d'une ligne de Pix.
+func (pbm *PBM) Stride() int {
+	return pbm.stride
+}
+
+// BitAt retourne la valeur du pixel en (x, y) : true pour noir.
+func (pbm *PBM) BitAt(x, y int) bool {
+	if x >= 0 && x < pbm.width && y >= 0 && y < pbm.height {
+		return pbm.bit(x, y)
 	}
+	return false
+}
 
-	fmt.Printf("%v\n", pbm)
-	return &pbm, nil
+// SetBit défini la valeur du pixel à (x, y) : true pour noir.
+func (pbm *PBM) SetBit(x, y int, value bool) {
+	if x >= 0 && x < pbm.width && y >= 0 && y < pbm.height {
+		pbm.putBit(x, y, value)
+	}
 }
 
-// Size retourne la hauteur et la largeur de l'image.
-func (pbm *PBM) Size() (int, int) {
-	return pbm.height, pbm.width
+// bit retourne le pixel en (x, y), sans vérifier les limites.
+func (pbm *PBM) bit(x, y int) bool {
+	return pbm.pix[y*pbm.stride+x/64]>>(63-x%64)&1 == 1
 }
 
-// At retourne la valeur de chaque pixel en (x, y).
-func (pbm *PBM) At(x, y int) bool {
-	return pbm.data[x][y]
+// putBit définit le pixel en (x, y), sans vérifier les limites.
+func (pbm *PBM) putBit(x, y int, value bool) {
+	mask := uint64(1) << (63 - x%64)
+	if value {
+		pbm.pix[y*pbm.stride+x/64] |= mask
+	} else {
+		pbm.pix[y*pbm.stride+x/64] &^= mask
+	}
 }
 
-// Set défini la valeur de chaque pixel à (x, y).
-func (pbm *PBM) Set(x, y int, value bool) {
-	pbm.data[x][y] = value
+// row retourne les mots de la ligne y.
+func (pbm *PBM) row(y int) []uint64 {
+	return pbm.pix[y*pbm.stride : (y+1)*pbm.stride]
+}
+
+// ColorModel retourne le modèle de couleur de l'image PBM (image.Image).
+func (pbm *PBM) ColorModel() color.Model {
+	return color.GrayModel
+}
+
+// Bounds retourne le rectangle couvert par l'image PBM (image.Image).
+func (pbm *PBM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, pbm.width, pbm.height)
+}
+
+// At retourne la couleur du pixel en (x, y) : noir ou blanc (image.Image).
+func (pbm *PBM) At(x, y int) color.Color {
+	if pbm.BitAt(x, y) {
+		return color.Gray{Y: 0}
+	}
+	return color.Gray{Y: 255}
+}
+
+// Set définit le pixel en (x, y) : noir si la couleur est plus sombre que le gris moyen (draw.Image).
+func (pbm *PBM) Set(x, y int, c color.Color) {
+	gray := color.GrayModel.Convert(c).(color.Gray)
+	pbm.SetBit(x, y, gray.Y < 128)
+}
+
+// PBMFromImage crée une image PBM (P1) à partir de n'importe quelle image.Image par seuillage au gris moyen.
+func PBMFromImage(img image.Image) *PBM {
+	bounds := img.Bounds()
+	pbm := newPBM(bounds.Dx(), bounds.Dy(), "P1")
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			pbm.Set(x, y, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return pbm
 }
 
 // Save enregistre l'image PBM dans un fichier et retourne une erreur en cas de problème.
 func (pbm *PBM) Save(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("error creating file: %v", err)
+	return saveFile(filename, pbm.Encode)
+}
+
+// Encode écrit l'image PBM dans w au format indiqué par le magic number.
+func (pbm *PBM) Encode(w io.Writer) error {
+	return pbm.encode(w, nil)
+}
+
+// encode écrit l'image PBM dans w, avec la mise en page ASCII choisie par o.
+func (pbm *PBM) encode(w io.Writer, o *EncodeOptions) error {
+	if pbm.magicNumber != "P1" && pbm.magicNumber != "P4" {
+		return fmt.Errorf("invalid magic number: %s", pbm.magicNumber)
 	}
-	defer file.Close()
+	writer := bufio.NewWriter(w)
 
-	// Ecrire le magique number et la taille de l'image dans le nouveau fichier
-	_, err = fmt.Fprintf(file, "%s\n%d %d\n", pbm.magicNumber, pbm.width, pbm.height)
+	// Ecrire le magique number, les commentaires et la taille de l'image
+	h := o.header(Header{MagicNumber: pbm.magicNumber, Width: pbm.width, Height: pbm.height, Comments: pbm.comments})
+	err := writeHeader(writer, h)
 	if err != nil {
-		return fmt.Errorf("error writing magic number and dimensions: %v", err)
+		return err
 	}
 
 	// Entrer les donnees de l'image
 	if pbm.magicNumber == "P1" { //Pour le P1
-		for _, row := range pbm.data {
-			for _, pixel := range row {
-				if pixel {
-					_, err = file.WriteString("1 ")
+		pw := newPlainWriter(writer, pbm.magicNumber, o)
+		for y := 0; y < pbm.height; y++ {
+			for x := 0; x < pbm.width; x++ {
+				if pbm.bit(x, y) {
+					err = pw.writeSample(1)
 				} else {
-					_, err = file.WriteString("0 ")
+					err = pw.writeSample(0)
 				}
 				if err != nil {
-					return fmt.Errorf("error writing pixel data: %v", err)
+					return fmt.Errorf("error writing pixel data at row %d: %v", y, err)
 				}
 			}
-			_, err = file.WriteString("\n")
-			if err != nil {
-				return fmt.Errorf("error writing pixel data: %v", err)
+			if err = pw.endRow(); err != nil {
+				return fmt.Errorf("error writing pixel data at row %d: %v", y, err)
 			}
 		}
 	} else if pbm.magicNumber == "P4" {
-		// Parcourir chaque ligne de l'image.
-		for _, row := range pbm.data {
-			// Parcourir les pixels par groupe de 8 (octets).
-			for x := 0; x < pbm.width; x += 8 {
-				var byteValue byte
-				// Parcourir les 8 pixels du groupe et construire la valeur du byte correspondant.
-				for i := 0; i < 8 && x+i < pbm.width; i++ {
-					bitIndex := 7 - i
-					// Si le pixel est vrai (noir), définir le bit correspondant à 1.
-					if row[x+i] {
-						byteValue |= 1 << bitIndex
-					}
-				}
-				// Écrire le byte (groupe de 8 pixels) dans le fichier.
-				_, err = file.Write([]byte{byteValue})
-				if err != nil {
-					return fmt.Errorf("erreur lors de l'écriture des données des pixels : %v", err)
-				}
+		// Chaque ligne P4 est le début des mots de la ligne écrits en
+		// big-endian : ceil(width/8) octets, bits de remplissage à zéro.
+		row := make([]byte, 8*pbm.stride)
+		for y := 0; y < pbm.height; y++ {
+			for i, word := range pbm.row(y) {
+				binary.BigEndian.PutUint64(row[8*i:], word)
+			}
+			_, err = writer.Write(row[:(pbm.width+7)/8])
+			if err != nil {
+				return fmt.Errorf("erreur lors de l'écriture des données des pixels : %v", err)
 			}
 		}
 	}
 
-	return nil
+	return writer.Flush()
 }
 
 // Invert inverse les couleurs de l'image PBM.
 func (pbm *PBM) Invert() {
+	for i := range pbm.pix {
+		pbm.pix[i] = ^pbm.pix[i]
+	}
+	pbm.clearPadding()
+	pbm.record("Invert")
+}
+
+// clearPadding remet à zéro les bits de remplissage en fin de chaque ligne.
+func (pbm *PBM) clearPadding() {
+	if pbm.width%64 == 0 {
+		return
+	}
+	mask := ^uint64(0) << (64 - pbm.width%64)
 	for y := 0; y < pbm.height; y++ {
-		for x := 0; x < pbm.width; x++ {
-			pbm.data[y][x] = !pbm.data[y][x]
-		}
+		pbm.pix[y*pbm.stride+pbm.stride-1] &= mask
 	}
 }
 
-// Flip retourne horizontalement l'image PBM.
+// Flip retourne horizontalement l'image PBM, mot par mot : l'ordre des mots et
+// celui des bits de chaque mot sont inversés, puis la ligne est décalée pour
+// ramener le remplissage en fin de ligne.
 func (pbm *PBM) Flip() {
+	pad := uint(64*pbm.stride - pbm.width)
 	for y := 0; y < pbm.height; y++ {
-		start := make([]bool, pbm.width)
-		end := make([]bool, pbm.width)
-		copy(start, pbm.data[y])
-		for i := 0; i < len(start); i++ {
-			end[i] = start[len(start)-1-i]
+		row := pbm.row(y)
+		for i, j := 0, len(row)-1; i <= j; i, j = i+1, j-1 {
+			row[i], row[j] = bits.Reverse64(row[j]), bits.Reverse64(row[i])
+		}
+		if pad > 0 {
+			for i := range row {
+				row[i] <<= pad
+				if i+1 < len(row) {
+					row[i] |= row[i+1] >> (64 - pad)
+				}
+			}
 		}
-		copy(pbm.data[y], end[:])
-
 	}
+	pbm.record("Flip")
 }
 
 // Flop retourne verticalement l'image PBM.
 func (pbm *PBM) Flop() {
-	cursor := pbm.height - 1
-	for y := range pbm.data {
-		// Échanger les données de la ligne actuelle avec la ligne correspondante en partant du bas.
-		temp := pbm.data[y]
-		pbm.data[y] = pbm.data[cursor]
-		pbm.data[cursor] = temp
-		cursor--
-		if cursor < y || cursor == y {
-			break
+	swapRows(pbm.pix, pbm.stride, pbm.height)
+	pbm.record("Flop")
+}
+
+// Rotate90CW fait pivoter l'image PBM de 90 degrés dans le sens des aiguilles d'une montre.
+func (pbm *PBM) Rotate90CW() {
+	rotated := newPBM(pbm.height, pbm.width, pbm.magicNumber)
+	for y := 0; y < rotated.height; y++ {
+		for x := 0; x < rotated.width; x++ {
+			rotated.putBit(x, y, pbm.bit(y, pbm.height-x-1))
 		}
 	}
+
+	pbm.pix, pbm.stride = rotated.pix, rotated.stride
+	pbm.width, pbm.height = pbm.height, pbm.width
+	pbm.record("Rotate90CW")
+}
+
+// And garde noirs les pixels noirs à la fois dans l'image et dans other,
+// other étant placée avec son coin supérieur gauche en offset. Seuls les
+// pixels recouverts par other sont modifiés.
+func (pbm *PBM) And(other *PBM, offset Point) {
+	pbm.combine(other, offset, func(a, b uint64) uint64 { return a & b })
+	pbm.record("And at (%d, %d)", offset.X, offset.Y)
+}
+
+// Or noircit les pixels noirs de other, placée en offset, par exemple pour
+// superposer un tampon.
+func (pbm *PBM) Or(other *PBM, offset Point) {
+	pbm.combine(other, offset, func(a, b uint64) uint64 { return a | b })
+	pbm.record("Or at (%d, %d)", offset.X, offset.Y)
 }
 
-// SetMagicNumber définit le numéro magique de l'image PBM.
+// Xor ne garde noirs que les pixels qui diffèrent entre l'image et other,
+// placée en offset, par exemple pour comparer deux pages numérisées.
+func (pbm *PBM) Xor(other *PBM, offset Point) {
+	pbm.combine(other, offset, func(a, b uint64) uint64 { return a ^ b })
+	pbm.record("Xor at (%d, %d)", offset.X, offset.Y)
+}
+
+// AndNot blanchit les pixels noirs de other, placée en offset, par exemple
+// pour effacer une zone avec un masque.
+func (pbm *PBM) AndNot(other *PBM, offset Point) {
+	pbm.combine(other, offset, func(a, b uint64) uint64 { return a &^ b })
+	pbm.record("AndNot at (%d, %d)", offset.X, offset.Y)
+}
+
+// combine applique op mot par mot entre l'image et other décalée de offset,
+// sur la zone où elles se recouvrent.
+func (pbm *PBM) combine(other *PBM, offset Point, op func(a, b uint64) uint64) {
+	x0, x1 := max(offset.X, 0), min(offset.X+other.width, pbm.width)
+	y0, y1 := max(offset.Y, 0), min(offset.Y+other.height, pbm.height)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+
+	for y := y0; y < y1; y++ {
+		row, src := pbm.row(y), other.row(y-offset.Y)
+		for j := x0 / 64; j <= (x1-1)/64; j++ {
+			mask := spanMask(j, x0, x1)
+			word := wordAt(src, 64*j-offset.X)
+			row[j] = row[j]&^mask | op(row[j], word)&mask
+		}
+	}
+}
+
+// wordAt retourne les 64 bits de row qui commencent au bit p, le bit p en
+// poids fort ; les bits hors de row valent zéro, p pouvant être négatif.
+func wordAt(row []uint64, p int) uint64 {
+	i, s := p>>6, uint(p&63)
+	var hi, lo uint64
+	if i >= 0 && i < len(row) {
+		hi = row[i]
+	}
+	if i+1 >= 0 && i+1 < len(row) {
+		lo = row[i+1]
+	}
+	if s == 0 {
+		return hi
+	}
+	return hi<<s | lo>>(64-s)
+}
+
+// spanMask retourne le masque des bits du mot j qui couvrent les colonnes [x0, x1).
+func spanMask(j, x0, x1 int) uint64 {
+	start, end := max(x0-64*j, 0), min(x1-64*j, 64)
+	if start >= end {
+		return 0
+	}
+	return ^uint64(0) >> uint(start) & (^uint64(0) << uint(64-end))
+}
+
+// SetMagicNumber définit le numéro magique de l'image PBM : "P1" ou "P4".
+// Tout autre magic number est ignoré.
 func (pbm *PBM) SetMagicNumber(magicNumber string) {
-	pbm.magicNumber = magicNumber
+	if magicNumber == "P1" || magicNumber == "P4" {
+		pbm.magicNumber = magicNumber
+	}
+}
 
+// ToPAM convertit l'image PBM en une image PAM de type BLACKANDWHITE (0 pour noir, 1 pour blanc).
+func (pbm *PBM) ToPAM() *PAM {
+	pam := NewPAM(pbm.width, pbm.height, 1, 1, TupleTypeBlackAndWhite)
+	pam.annotations = pbm.derive("ToPAM")
+	for y := 0; y < pbm.height; y++ {
+		for x := 0; x < pbm.width; x++ {
+			if !pbm.bit(x, y) {
+				pam.data[y][x] = 1
+			}
+		}
+	}
+	return pam
 }
@@ -0,0 +1,204 @@
+package Netpbm
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// testWidths couvre les largeurs autour des limites de mots de 64 bits.
+var testWidths = []int{1, 7, 63, 64, 65, 100, 130}
+
+// randomPBM crée une image PBM aux pixels pseudo-aléatoires, reproductibles d'après seed.
+func randomPBM(width, height int, seed int64) *PBM {
+	r := rand.New(rand.NewSource(seed))
+	pbm := newPBM(width, height, "P1")
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pbm.putBit(x, y, r.Intn(2) == 1)
+		}
+	}
+	return pbm
+}
+
+// checkPadding vérifie que les bits de remplissage de chaque ligne sont à zéro.
+func checkPadding(t *testing.T, pbm *PBM) {
+	t.Helper()
+	if pbm.width%64 == 0 {
+		return
+	}
+	mask := ^uint64(0) >> (pbm.width % 64)
+	for y := 0; y < pbm.height; y++ {
+		if word := pbm.pix[y*pbm.stride+pbm.stride-1]; word&mask != 0 {
+			t.Fatalf("row %d: padding bits set in %#016x", y, word)
+		}
+	}
+}
+
+func TestPBMFlip(t *testing.T) {
+	for _, width := range testWidths {
+		pbm := randomPBM(width, 3, int64(width))
+		want := pbm.clone()
+		pbm.Flip()
+		checkPadding(t, pbm)
+		for y := 0; y < pbm.height; y++ {
+			for x := 0; x < width; x++ {
+				if pbm.bit(x, y) != want.bit(width-1-x, y) {
+					t.Fatalf("width %d: pixel (%d, %d) not mirrored", width, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestPBMInvert(t *testing.T) {
+	for _, width := range testWidths {
+		pbm := randomPBM(width, 3, int64(width))
+		want := pbm.clone()
+		pbm.Invert()
+		checkPadding(t, pbm)
+		for y := 0; y < pbm.height; y++ {
+			for x := 0; x < width; x++ {
+				if pbm.bit(x, y) == want.bit(x, y) {
+					t.Fatalf("width %d: pixel (%d, %d) not inverted", width, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestPBMRoundTrip(t *testing.T) {
+	for _, magicNumber := range []string{"P1", "P4"} {
+		for _, width := range testWidths {
+			pbm := randomPBM(width, 5, int64(width))
+			pbm.magicNumber = magicNumber
+
+			var buf bytes.Buffer
+			if err := pbm.Encode(&buf); err != nil {
+				t.Fatalf("%s width %d: Encode: %v", magicNumber, width, err)
+			}
+			got, err := DecodePBM(&buf)
+			if err != nil {
+				t.Fatalf("%s width %d: DecodePBM: %v", magicNumber, width, err)
+			}
+			if got.width != width || got.height != pbm.height {
+				t.Fatalf("%s width %d: decoded size %dx%d", magicNumber, width, got.width, got.height)
+			}
+			checkPadding(t, got)
+			for i := range pbm.pix {
+				if got.pix[i] != pbm.pix[i] {
+					t.Fatalf("%s width %d: word %d is %#016x, want %#016x", magicNumber, width, i, got.pix[i], pbm.pix[i])
+				}
+			}
+		}
+	}
+}
+
+func TestP4RasterSize(t *testing.T) {
+	for _, width := range testWidths {
+		pbm := randomPBM(width, 4, int64(width))
+		pbm.magicNumber = "P4"
+
+		var buf bytes.Buffer
+		if err := pbm.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		h, err := DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := int64(buf.Len())-h.RasterOffset, int64(4*((width+7)/8)); got != want {
+			t.Errorf("width %d: raster of %d bytes, want %d", width, got, want)
+		}
+	}
+}
+
+func TestWordAt(t *testing.T) {
+	row := []uint64{0x0123456789abcdef, 0xfedcba9876543210}
+	tests := []struct {
+		p    int
+		want uint64
+	}{
+		{0, 0x0123456789abcdef},
+		{64, 0xfedcba9876543210},
+		{4, 0x123456789abcdeff},
+		{68, 0xedcba98765432100},
+		{-4, 0x00123456789abcde},
+		{-64, 0},
+		{-70, 0},
+		{128, 0},
+		{124, 0},
+		{60, 0xffedcba987654321},
+	}
+	for _, tt := range tests {
+		if got := wordAt(row, tt.p); got != tt.want {
+			t.Errorf("wordAt(%d) = %#016x, want %#016x", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestSpanMask(t *testing.T) {
+	tests := []struct {
+		j, x0, x1 int
+		want      uint64
+	}{
+		{0, 0, 64, ^uint64(0)},
+		{0, 0, 1, 1 << 63},
+		{0, 63, 64, 1},
+		{0, 4, 8, 0x0f00000000000000},
+		{1, 0, 64, 0},
+		{1, 60, 68, 0xf000000000000000},
+		{0, 60, 68, 0xf},
+		{2, 100, 130, 0xc000000000000000},
+	}
+	for _, tt := range tests {
+		if got := spanMask(tt.j, tt.x0, tt.x1); got != tt.want {
+			t.Errorf("spanMask(%d, %d, %d) = %#016x, want %#016x", tt.j, tt.x0, tt.x1, got, tt.want)
+		}
+	}
+}
+
+func TestPBMCombine(t *testing.T) {
+	ops := []struct {
+		name  string
+		apply func(pbm, other *PBM, offset Point)
+		want  func(a, b bool) bool
+	}{
+		{"And", (*PBM).And, func(a, b bool) bool { return a && b }},
+		{"Or", (*PBM).Or, func(a, b bool) bool { return a || b }},
+		{"Xor", (*PBM).Xor, func(a, b bool) bool { return a != b }},
+		{"AndNot", (*PBM).AndNot, func(a, b bool) bool { return a && !b }},
+	}
+	offsets := []Point{
+		{0, 0}, {1, 0}, {-1, 0}, {5, 2}, {-3, -1},
+		{63, 0}, {64, 1}, {65, -1}, {-63, 0}, {-64, 2}, {-65, 0},
+		{100, 0}, {-130, 0}, {0, 10}, {0, -10},
+	}
+	for _, width := range testWidths {
+		for _, otherWidth := range []int{1, 7, 64, 70, 130} {
+			for _, offset := range offsets {
+				for _, op := range ops {
+					pbm := randomPBM(width, 6, int64(width))
+					other := randomPBM(otherWidth, 4, int64(otherWidth+1000))
+					want := pbm.clone()
+					op.apply(pbm, other, offset)
+
+					checkPadding(t, pbm)
+					for y := 0; y < pbm.height; y++ {
+						for x := 0; x < width; x++ {
+							expected := want.bit(x, y)
+							ox, oy := x-offset.X, y-offset.Y
+							if ox >= 0 && ox < other.width && oy >= 0 && oy < other.height {
+								expected = op.want(expected, other.bit(ox, oy))
+							}
+							if pbm.bit(x, y) != expected {
+								t.Fatalf("%s width %d, other width %d, offset %v: pixel (%d, %d) is %v, want %v",
+									op.name, width, otherWidth, offset, x, y, pbm.bit(x, y), expected)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package Netpbm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// PFM représente une image PFM (Portable Float Map) : "PF" en couleur, "Pf" en niveaux de gris.
+type PFM struct {
+	data          [][]float32 // lignes de haut en bas, width*channels échantillons entrelacés
+	width, height int
+	channels      int
+	magicNumber   string
+	scale         float32
+	littleEndian  bool
+}
+
+// NewPFM crée une image PFM vide ; magicNumber vaut "PF" (couleur) ou "Pf" (niveaux de gris).
+func NewPFM(width, height int, magicNumber string) *PFM {
+	pfm := &PFM{
+		data:         make([][]float32, height),
+		width:        width,
+		height:       height,
+		channels:     pfmChannels(magicNumber),
+		magicNumber:  magicNumber,
+		scale:        1,
+		littleEndian: true,
+	}
+	for y := range pfm.data {
+		pfm.data[y] = make([]float32, width*pfm.channels)
+	}
+	return pfm
+}
+
+// pfmChannels retourne le nombre d'échantillons par pixel pour le magic number donné.
+func pfmChannels(magicNumber string) int {
+	if magicNumber == "PF" {
+		return 3
+	}
+	return 1
+}
+
+// ReadPFM lit une image PFM depuis un fichier.
+func ReadPFM(filename string) (*PFM, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return DecodePFM(file)
+}
+
+// DecodePFM lit une image PFM depuis r. Le signe du facteur d'échelle donne
+// l'ordre des octets (négatif pour little-endian) et les lignes sont stockées
+// de bas en haut.
+func DecodePFM(r io.Reader) (*PFM, error) {
+	return decodePFM(newTokenReader(r, nil))
+}
+
+// decodePFM décode une image PFM depuis t, sans lire au-delà de son raster.
+func decodePFM(t *tokenReader) (*PFM, error) {
+	// Lire l'en-tête : dimensions et facteur d'échelle.
+	h, err := t.readHeader("PF", "Pf")
+	if err != nil {
+		return nil, err
+	}
+	width, height := h.Width, h.Height
+
+	pfm := NewPFM(width, height, h.MagicNumber)
+	pfm.scale = float32(math.Abs(h.Scale))
+	pfm.littleEndian = h.Scale < 0
+
+	// Lire le raster, de la dernière ligne de l'image à la première.
+	var order binary.ByteOrder = binary.BigEndian
+	if pfm.littleEndian {
+		order = binary.LittleEndian
+	}
+	row := make([]byte, width*pfm.channels*4)
+	for i := 0; i < height; i++ {
+		y := height - 1 - i
+		n, err := t.read(row)
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, t.ioError(err, y, -1, "pixel data")
+			}
+			// En mode tolérant, les lignes manquantes restent à zéro.
+			if err := t.offSpec(ErrTruncated, y, -1, "unexpected end of file, expected %d bytes, got %d", len(row), n); err != nil {
+				return nil, err
+			}
+			clear(row[n-n%4:])
+			for j := range pfm.data[y] {
+				pfm.data[y][j] = math.Float32frombits(order.Uint32(row[4*j:]))
+			}
+			break
+		}
+		for j := range pfm.data[y] {
+			pfm.data[y][j] = math.Float32frombits(order.Uint32(row[4*j:]))
+		}
+	}
+
+	return pfm, nil
+}
+
+// Size retourne la largeur et la hauteur de l'image PFM.
+func (pfm *PFM) Size() (int, int) {
+	return pfm.width, pfm.height
+}
+
+// MagicNumber retourne le numéro magique de l'image PFM.
+func (pfm *PFM) MagicNumber() string {
+	return pfm.magicNumber
+}
+
+// SetMagicNumber passe l'image en couleur ("PF") ou en niveaux de gris ("Pf"),
+// en dupliquant ou en moyennant les composantes.
+func (pfm *PFM) SetMagicNumber(magicNumber string) {
+	channels := pfmChannels(magicNumber)
+	if (magicNumber != "PF" && magicNumber != "Pf") || channels == pfm.channels {
+		return
+	}
+
+	for y := range pfm.data {
+		row := make([]float32, pfm.width*channels)
+		for x := 0; x < pfm.width; x++ {
+			if channels == 1 {
+				old := pfm.data[y][3*x : 3*x+3]
+				row[x] = (old[0] + old[1] + old[2]) / 3
+			} else {
+				v := pfm.data[y][x]
+				row[3*x], row[3*x+1], row[3*x+2] = v, v, v
+			}
+		}
+		pfm.data[y] = row
+	}
+	pfm.channels = channels
+	pfm.magicNumber = magicNumber
+}
+
+// Channels retourne le nombre d'échantillons par pixel (3 pour PF, 1 pour Pf).
+func (pfm *PFM) Channels() int {
+	return pfm.channels
+}
+
+// Scale retourne la valeur absolue du facteur d'échelle de l'image PFM.
+func (pfm *PFM) Scale() float32 {
+	return pfm.scale
+}
+
+// SetScale définit le facteur d'échelle de l'image PFM.
+func (pfm *PFM) SetScale(scale float32) {
+	pfm.scale = float32(math.Abs(float64(scale)))
+}
+
+// LittleEndian indique si le raster est écrit en little-endian.
+func (pfm *PFM) LittleEndian() bool {
+	return pfm.littleEndian
+}
+
+// SetLittleEndian choisit l'ordre des octets utilisé par Save et Encode.
+func (pfm *PFM) SetLittleEndian(littleEndian bool) {
+	pfm.littleEndian = littleEndian
+}
+
+// Tuple retourne une copie des échantillons du pixel à la position (x, y).
+func (pfm *PFM) Tuple(x, y int) []float32 {
+	if x < 0 || x >= pfm.width || y < 0 || y >= pfm.height {
+		return nil
+	}
+	tuple := make([]float32, pfm.channels)
+	copy(tuple, pfm.data[y][x*pfm.channels:(x+1)*pfm.channels])
+	return tuple
+}
+
+// SetTuple définit les échantillons du pixel à la position (x, y).
+func (pfm *PFM) SetTuple(x, y int, tuple []float32) {
+	if x >= 0 && x < pfm.width && y >= 0 && y < pfm.height {
+		copy(pfm.data[y][x*pfm.channels:(x+1)*pfm.channels], tuple)
+	}
+}
+
+// Invert remplace chaque valeur v par 1 - v, l'image étant supposée normalisée dans [0, 1].
+func (pfm *PFM) Invert() {
+	for y := range pfm.data {
+		for i := range pfm.data[y] {
+			pfm.data[y][i] = 1 - pfm.data[y][i]
+		}
+	}
+}
+
+// Flip retourne l'image PFM horizontalement.
+func (pfm *PFM) Flip() {
+	for y := range pfm.data {
+		flipTuples(pfm.data[y], pfm.channels)
+	}
+}
+
+// Flop retourne l'image PFM verticalement.
+func (pfm *PFM) Flop() {
+	for i := 0; i < pfm.height/2; i++ {
+		pfm.data[i], pfm.data[pfm.height-i-1] = pfm.data[pfm.height-i-1], pfm.data[i]
+	}
+}
+
+// Rotate90CW fait pivoter l'image PFM de 90 degrés dans le sens des aiguilles d'une montre.
+func (pfm *PFM) Rotate90CW() {
+	pfm.data = rotateTuples(pfm.data, pfm.width, pfm.height, pfm.channels)
+	pfm.width, pfm.height = pfm.height, pfm.width
+}
+
+// ColorModel retourne color.RGBA64Model pour PF et color.Gray16Model pour Pf (image.Image).
+func (pfm *PFM) ColorModel() color.Model {
+	if pfm.channels == 3 {
+		return color.RGBA64Model
+	}
+	return color.Gray16Model
+}
+
+// Bounds retourne le rectangle couvert par l'image PFM (image.Image).
+func (pfm *PFM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, pfm.width, pfm.height)
+}
+
+// At retourne la couleur du pixel en (x, y), écrêtée dans [0, 1] puis ramenée sur 16 bits (image.Image).
+func (pfm *PFM) At(x, y int) color.Color {
+	tuple := pfm.Tuple(x, y)
+	if tuple == nil {
+		if pfm.channels == 3 {
+			return color.RGBA64{}
+		}
+		return color.Gray16{}
+	}
+
+	tm := LinearClamp()
+	scale := func(v float32) uint16 {
+		return uint16(math.Round(tm(v) * 65535))
+	}
+	if pfm.channels == 3 {
+		return color.RGBA64{R: scale(tuple[0]), G: scale(tuple[1]), B: scale(tuple[2]), A: 65535}
+	}
+	return color.Gray16{Y: scale(tuple[0])}
+}
+
+// Save enregistre l'image PFM dans un fichier.
+func (pfm *PFM) Save(filename string) error {
+	return saveFile(filename, pfm.Encode)
+}
+
+// Encode écrit l'image PFM dans w, les lignes de bas en haut.
+func (pfm *PFM) Encode(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+
+	// Le signe du facteur d'échelle indique l'ordre des octets.
+	scale := float64(pfm.scale)
+	if scale == 0 {
+		scale = 1
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if pfm.littleEndian {
+		order = binary.LittleEndian
+		scale = -scale
+	}
+
+	_, err := fmt.Fprintf(writer, "%s\n%d %d\n%s\n", pfm.magicNumber, pfm.width, pfm.height, strconv.FormatFloat(scale, 'f', -1, 32))
+	if err != nil {
+		return fmt.Errorf("error writing header: %v", err)
+	}
+
+	row := make([]byte, pfm.width*pfm.channels*4)
+	for y := pfm.height - 1; y >= 0; y-- {
+		for j, v := range pfm.data[y] {
+			order.PutUint32(row[4*j:], math.Float32bits(v))
+		}
+		_, err = writer.Write(row)
+		if err != nil {
+			return fmt.Errorf("error writing pixel data at row %d: %v", y, err)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// ToneMap ramène une valeur HDR dans l'intervalle [0, 1].
+type ToneMap func(v float32) float64
+
+// LinearClamp retourne un ToneMap qui écrête simplement les valeurs dans [0, 1].
+func LinearClamp() ToneMap {
+	return func(v float32) float64 {
+		return clamp01(float64(v))
+	}
+}
+
+// Reinhard retourne l'opérateur de Reinhard v / (1 + v).
+func Reinhard() ToneMap {
+	return func(v float32) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return clamp01(float64(v) / (1 + float64(v)))
+	}
+}
+
+// Exposure retourne un ToneMap 1 - exp(-v * 2^stops), où stops règle l'exposition.
+func Exposure(stops float64) ToneMap {
+	gain := math.Exp2(stops)
+	return func(v float32) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return clamp01(1 - math.Exp(-float64(v)*gain))
+	}
+}
+
+// clamp01 limite v à l'intervalle [0, 1].
+func clamp01(v float64) float64 {
+	if math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// ToPGM convertit l'image PFM en une image PGM de valeur maximale max en appliquant tm, la moyenne des composantes étant prise pour les images couleur.
+func (pfm *PFM) ToPGM(tm ToneMap, max uint16) *PGM {
+	pgm := newPGM(pfm.width, pfm.height, "P2", uint(max))
+
+	for y := 0; y < pfm.height; y++ {
+		for x := 0; x < pfm.width; x++ {
+			var sum float64
+			for _, v := range pfm.data[y][x*pfm.channels : (x+1)*pfm.channels] {
+				sum += tm(v)
+			}
+			pgm.putValue(x, y, uint16(math.Round(sum/float64(pfm.channels)*float64(max))))
+		}
+	}
+
+	return pgm
+}
+
+// ToPPM convertit l'image PFM en une image PPM de valeur maximale max en appliquant tm à chaque composante.
+func (pfm *PFM) ToPPM(tm ToneMap, max uint16) *PPM {
+	ppm := newPPM(pfm.width, pfm.height, "P3", uint(max))
+
+	scale := func(v float32) uint16 {
+		return uint16(math.Round(tm(v) * float64(max)))
+	}
+	for y := 0; y < pfm.height; y++ {
+		for x := 0; x < pfm.width; x++ {
+			tuple := pfm.data[y][x*pfm.channels : (x+1)*pfm.channels]
+			if pfm.channels == 3 {
+				ppm.putPixel(x, y, Pixel{R: scale(tuple[0]), G: scale(tuple[1]), B: scale(tuple[2])})
+			} else {
+				gray := scale(tuple[0])
+				ppm.putPixel(x, y, Pixel{R: gray, G: gray, B: gray})
+			}
+		}
+	}
+
+	return ppm
+}
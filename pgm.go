@@ -3,18 +3,28 @@ package Netpbm
 import (
 	"bufio"
 	"fmt"
+	"image"
+	"image/color"
 	"io"
 	"os"
-	"strings"
 )
 
 type PGM struct {
-	data          [][]uint8
+	pix           []byte // échantillons comme en P5 : un octet, ou deux octets big-endian si max dépasse 255
+	stride        int    // octets par ligne de pix
 	width, height int
 	magicNumber   string
 	max           uint
+	annotations
 }
 
+// newPGM crée une image PGM noire de width×height pixels.
+func newPGM(width, height int, magicNumber string, max uint) *PGM {
+	stride := width * bytesPerSample(max)
+	return &PGM{pix: make([]byte, stride*height), stride: stride, width: width, height: height, magicNumber: magicNumber, max: max}
+}
+
+// ReadPGM lit une image PGM depuis un fichier et retourne la struct PGM.
 func ReadPGM(filename string) (*PGM, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -22,96 +32,38 @@ func ReadPGM(filename string) (*PGM, error) {
 	}
 	defer file.Close()
 
-	reader := bufio.NewReader(file)
-
-	// Lire magic number
-	magicNumber, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("error reading magic number: %v", err)
-	}
-	magicNumber = strings.TrimSpace(magicNumber)
-	if magicNumber != "P2" && magicNumber != "P5" {
-		return nil, fmt.Errorf("invalid magic number: %s", magicNumber)
-	}
+	return DecodePGM(file)
+}
 
-	// Lire les dimensions
-	dimensions, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("error reading dimensions: %v", err)
-	}
-	var width, height int
-	_, err = fmt.Sscanf(strings.TrimSpace(dimensions), "%d %d", &width, &height)
-	if err != nil {
-		return nil, fmt.Errorf("invalid dimensions: %v", err)
-	}
-	if width <= 0 || height <= 0 {
-		return nil, fmt.Errorf("invalid dimensions: width and height must be positive")
-	}
+// DecodePGM lit une image PGM (P2 ou P5) depuis r et retourne la struct PGM.
+func DecodePGM(r io.Reader) (*PGM, error) {
+	return decodePGM(newTokenReader(r, nil))
+}
 
-	// Lire la valeur maximale
-	maxValue, err := reader.ReadString('\n')
+// decodePGM décode une image PGM depuis t, sans lire au-delà de son raster.
+func decodePGM(t *tokenReader) (*PGM, error) {
+	// Lire l'en-tête : magic number, dimensions et valeur maximale.
+	h, err := t.readHeader("P2", "P5")
 	if err != nil {
-		return nil, fmt.Errorf("error reading max value: %v", err)
-	}
-	maxValue = strings.TrimSpace(maxValue)
-	var max uint
-	_, err = fmt.Sscanf(maxValue, "%d", &max)
-	if err != nil {
-		return nil, fmt.Errorf("invalid max value: %v", err)
+		return nil, err
 	}
+	pgm := newPGM(h.Width, h.Height, h.MagicNumber, h.MaxValue)
+	pgm.comments = h.Comments
 
-	// Lire l'image data
-	data := make([][]uint8, height)
-	expectedBytesPerPixel := 1
-
-	if magicNumber == "P2" {
-		// Lire le format P2 (ASCII)
-		for y := 0; y < height; y++ {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				return nil, fmt.Errorf("error reading data at row %d: %v", y, err)
-			}
-			fields := strings.Fields(line)
-			rowData := make([]uint8, width)
-			for x, field := range fields {
-				if x >= width {
-					return nil, fmt.Errorf("index out of range at row %d", y)
-				}
-				var pixelValue uint8
-				_, err := fmt.Sscanf(field, "%d", &pixelValue)
-				if err != nil {
-					return nil, fmt.Errorf("error parsing pixel value at row %d, column %d: %v", y, x, err)
-				}
-				rowData[x] = pixelValue
-			}
-			data[y] = rowData
+	// Lire l'image data, ligne par ligne (P2 en ASCII, P5 en binaire).
+	rows := newRowReader(t, h)
+	row := make([]uint16, pgm.width)
+	for y := 0; y < pgm.height; y++ {
+		if err := rows.ReadRow(row); err != nil {
+			return nil, err
 		}
-	} else if magicNumber == "P5" {
-		// Lire le format P5 (binary)
-		for y := 0; y < height; y++ {
-			row := make([]byte, width*expectedBytesPerPixel)
-			n, err := reader.Read(row)
-			if err != nil {
-				if err == io.EOF {
-					return nil, fmt.Errorf("unexpected end of file at row %d", y)
-				}
-				return nil, fmt.Errorf("error reading pixel data at row %d: %v", y, err)
-			}
-			if n < width*expectedBytesPerPixel {
-				return nil, fmt.Errorf("unexpected end of file at row %d, expected %d bytes, got %d", y, width*expectedBytesPerPixel, n)
-			}
-
-			rowData := make([]uint8, width)
-			for x := 0; x < width; x++ {
-				pixelValue := uint8(row[x*expectedBytesPerPixel])
-				rowData[x] = pixelValue
-			}
-			data[y] = rowData
+		for x, value := range row {
+			pgm.putValue(x, y, value)
 		}
 	}
 
 	// Return la struct PGM
-	return &PGM{data, width, height, magicNumber, max}, nil
+	return pgm, nil
 }
 
 // Size retourne la largeur et la hauteur de l'image PGM.
@@ -119,57 +71,117 @@ func (pgm *PGM) Size() (int, int) {
 	return pgm.width, pgm.height
 }
 
-// At retourne la valeur du pixel à la position (x, y) dans l'image PGM.
-func (pgm *PGM) At(x, y int) uint8 {
+// MagicNumber retourne le numéro magique de l'image PGM.
+func (pgm *PGM) MagicNumber() string {
+	return pgm.magicNumber
+}
+
+// Pix retourne le raster de l'image, partagé avec elle : Height lignes de
+// Stride octets au format P5, un octet par pixel, ou deux octets big-endian si
+// la valeur maximale dépasse 255.
+func (pgm *PGM) Pix() []byte {
+	return pgm.pix
+}
+
+// Stride retourne le nombre d'octets d'une ligne de Pix.
+func (pgm *PGM) Stride() int {
+	return pgm.stride
+}
+
+// ValueAt retourne la valeur du pixel à la position (x, y) dans l'image PGM.
+func (pgm *PGM) ValueAt(x, y int) uint16 {
 	if x >= 0 && x < pgm.width && y >= 0 && y < pgm.height {
-		return pgm.data[y][x]
+		return pgm.value(x, y)
 	}
 	return 0
 }
 
-// Set définit la valeur du pixel à la position (x, y).
-func (pgm *PGM) Set(x, y int, value uint8) {
+// SetValue définit la valeur du pixel à la position (x, y), ramenée à la valeur maximale si elle la dépasse.
+func (pgm *PGM) SetValue(x, y int, value uint16) {
 	if x >= 0 && x < pgm.width && y >= 0 && y < pgm.height {
-		pgm.data[y][x] = value
+		pgm.putValue(x, y, min(value, uint16(pgm.max)))
 	}
 }
 
-// Save enregistre l'image PGM dans un fichier au format opposé (P2 ou P5) et retourne une erreur en cas de problème.
-func (pgm *PGM) Save(filename string) error {
-	// Ouvrir le fichier pour écriture.
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+// value retourne la valeur du pixel en (x, y), sans vérifier les limites.
+func (pgm *PGM) value(x, y int) uint16 {
+	return getSample(pgm.pix[y*pgm.stride:], x, bytesPerSample(pgm.max))
+}
+
+// putValue définit la valeur du pixel en (x, y), sans vérifier les limites.
+func (pgm *PGM) putValue(x, y int, value uint16) {
+	putSample(pgm.pix[y*pgm.stride:], x, bytesPerSample(pgm.max), value)
+}
+
+// ColorModel retourne color.GrayModel, ou color.Gray16Model si la valeur maximale dépasse 255 (image.Image).
+func (pgm *PGM) ColorModel() color.Model {
+	if pgm.max > 255 {
+		return color.Gray16Model
 	}
-	defer file.Close()
+	return color.GrayModel
+}
 
-	// Créer un écrivain pour le fichier.
-	writer := bufio.NewWriter(file)
-	_, err = fmt.Fprintln(writer, pgm.magicNumber)
-	if err != nil {
-		return fmt.Errorf("error writing magic number: %v", err)
+// Bounds retourne le rectangle couvert par l'image PGM (image.Image).
+func (pgm *PGM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, pgm.width, pgm.height)
+}
+
+// At retourne la couleur du pixel en (x, y), ramenée de [0, max] à la pleine échelle de color.Gray ou color.Gray16 (image.Image).
+func (pgm *PGM) At(x, y int) color.Color {
+	value := pgm.ValueAt(x, y)
+	if pgm.max > 255 {
+		return color.Gray16{Y: scaleSample(value, pgm.max, 65535)}
 	}
+	return color.Gray{Y: uint8(scaleSample(value, pgm.max, 255))}
+}
 
-	// Écrire les dimensions.
-	_, err = fmt.Fprintf(writer, "%d %d\n", pgm.width, pgm.height)
-	if err != nil {
-		return fmt.Errorf("error writing dimensions: %v", err)
+// Set définit le pixel en (x, y) à partir de n'importe quelle couleur (draw.Image).
+func (pgm *PGM) Set(x, y int, c color.Color) {
+	gray := color.Gray16Model.Convert(c).(color.Gray16)
+	pgm.SetValue(x, y, scaleSample(gray.Y, 65535, pgm.max))
+}
+
+// PGMFromImage crée une image PGM (P2) à partir de n'importe quelle image.Image, sur 16 bits si la source l'est.
+func PGMFromImage(img image.Image) *PGM {
+	bounds := img.Bounds()
+	pgm := newPGM(bounds.Dx(), bounds.Dy(), "P2", maxValueOf(img))
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			pgm.Set(x, y, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
 	}
+	return pgm
+}
 
-	// Écrire la valeur maximale.
-	_, err = fmt.Fprintln(writer, pgm.max)
-	if err != nil {
-		return fmt.Errorf("error writing max value: %v", err)
+// Save enregistre l'image PGM dans un fichier au format indiqué par le magic number (P2 ou P5) et retourne une erreur en cas de problème.
+func (pgm *PGM) Save(filename string) error {
+	return saveFile(filename, pgm.Encode)
+}
+
+// Encode écrit l'image PGM dans w au format indiqué par le magic number (P2 ou P5).
+func (pgm *PGM) Encode(w io.Writer) error {
+	return pgm.encode(w, nil)
+}
+
+// encode écrit l'image PGM dans w, avec la mise en page ASCII choisie par o.
+func (pgm *PGM) encode(w io.Writer, o *EncodeOptions) error {
+	if pgm.magicNumber != "P2" && pgm.magicNumber != "P5" {
+		return fmt.Errorf("invalid magic number: %s", pgm.magicNumber)
 	}
-	for _, row := range pgm.data {
-		if len(row) != pgm.width {
-			return fmt.Errorf("inconsistent row length in data")
-		}
+
+	// Créer un écrivain tamponné.
+	writer := bufio.NewWriter(w)
+
+	// Écrire le magic number, les commentaires, les dimensions et la valeur maximale.
+	h := o.header(Header{MagicNumber: pgm.magicNumber, Width: pgm.width, Height: pgm.height, MaxValue: pgm.max, Comments: pgm.comments})
+	err := writeHeader(writer, h)
+	if err != nil {
+		return err
 	}
 
 	// Écrire les data de l'image.
 	if pgm.magicNumber == "P2" {
-		err = saveP2PGM(writer, pgm)
+		err = saveP2PGM(writer, pgm, o)
 		if err != nil {
 			return err
 		}
@@ -183,27 +195,20 @@ func (pgm *PGM) Save(filename string) error {
 	return writer.Flush()
 }
 
-// saveP2PGM enregistre l'image PGM dans le format P2 (ASCII).
-func saveP2PGM(file *bufio.Writer, pgm *PGM) error {
+// saveP2PGM enregistre l'image PGM dans le format P2 (ASCII), avec la mise en page choisie par o.
+func saveP2PGM(file *bufio.Writer, pgm *PGM, o *EncodeOptions) error {
+	pw := newPlainWriter(file, pgm.magicNumber, o)
 	for y := 0; y < pgm.height; y++ {
 		for x := 0; x < pgm.width; x++ {
 			// Écrire la valeur du pixel.
-			_, err := fmt.Fprint(file, pgm.data[y][x])
+			err := pw.writeSample(pgm.value(x, y))
 			if err != nil {
 				return fmt.Errorf("error writing pixel data at row %d, column %d: %v", y, x, err)
 			}
-
-			// Ajouter un espace après chaque pixel, sauf le dernier de la ligne.
-			if x < pgm.width-1 {
-				_, err = fmt.Fprint(file, " ")
-				if err != nil {
-					return fmt.Errorf("error writing space after pixel at row %d, column %d: %v", y, x, err)
-				}
-			}
 		}
 
 		// Ajouter une newline après chaque ligne.
-		_, err := fmt.Fprintln(file)
+		err := pw.endRow()
 		if err != nil {
 			return fmt.Errorf("error writing newline after row %d: %v", y, err)
 		}
@@ -211,65 +216,69 @@ func saveP2PGM(file *bufio.Writer, pgm *PGM) error {
 	return nil
 }
 
-// saveP5PGM enregistre l'image PGM dans le format P5 (binaire).
+// saveP5PGM enregistre l'image PGM dans le format P5 (binaire) : le raster est déjà à ce format et s'écrit tel quel.
 func saveP5PGM(file *bufio.Writer, pgm *PGM) error {
-	for y := 0; y < pgm.height; y++ {
-		row := make([]byte, pgm.width)
-		for x := 0; x < pgm.width; x++ {
-			row[x] = byte(pgm.data[y][x])
-		}
-		_, err := file.Write(row)
-		if err != nil {
-			return fmt.Errorf("error writing pixel data at row %d: %v", y, err)
-		}
+	_, err := file.Write(pgm.pix)
+	if err != nil {
+		return fmt.Errorf("error writing pixel data: %v", err)
 	}
 	return nil
 }
 
 // Invert inverse les couleurs de l'image PGM.
 func (pgm *PGM) Invert() {
-	for i := range pgm.data {
-		for j := range pgm.data[i] {
-			pgm.data[i][j] = uint8(pgm.max) - pgm.data[i][j]
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			// Une valeur au-delà de max, écrite par Pix, donne 0 au lieu de boucler.
+			pgm.putValue(x, y, uint16(pgm.max)-min(pgm.value(x, y), uint16(pgm.max)))
 		}
 	}
+	pgm.record("Invert")
 }
 
 // Flip retourne l'image PGM horizontalement.
 func (pgm *PGM) Flip() {
-	for i := range pgm.data {
-		for j, k := 0, len(pgm.data[i])-1; j < k; j, k = j+1, k-1 {
-			pgm.data[i][j], pgm.data[i][k] = pgm.data[i][k], pgm.data[i][j]
+	for y := 0; y < pgm.height; y++ {
+		for i, j := 0, pgm.width-1; i < j; i, j = i+1, j-1 {
+			left, right := pgm.value(i, y), pgm.value(j, y)
+			pgm.putValue(i, y, right)
+			pgm.putValue(j, y, left)
 		}
 	}
+	pgm.record("Flip")
 }
 
 // Flop retourne l'image PGM verticalement.
 func (pgm *PGM) Flop() {
-	for i := 0; i < pgm.height/2; i++ {
-		pgm.data[i], pgm.data[pgm.height-i-1] = pgm.data[pgm.height-i-1], pgm.data[i]
-	}
+	swapRows(pgm.pix, pgm.stride, pgm.height)
+	pgm.record("Flop")
 }
 
-// SetMagicNumber définit le numéro magique de l'image PGM.
+// SetMagicNumber définit le numéro magique de l'image PGM : "P2" ou "P5".
+// Tout autre magic number est ignoré.
 func (pgm *PGM) SetMagicNumber(magicNumber string) {
-	pgm.magicNumber = magicNumber
+	if magicNumber == "P2" || magicNumber == "P5" {
+		pgm.magicNumber = magicNumber
+	}
 }
 
 // SetMaxValue définit la valeur maximale des pixels dans l'image PGM.
-func (pgm *PGM) SetMaxValue(maxValue uint8) {
+func (pgm *PGM) SetMaxValue(maxValue uint16) {
+	// Le raster change de taille si les pixels passent d'un à deux octets.
+	scaled := newPGM(pgm.width, pgm.height, pgm.magicNumber, uint(maxValue))
 	for y := 0; y < pgm.height; y++ {
 		for x := 0; x < pgm.width; x++ {
 			// Calculer la nouvelle valeur du pixel en ajustant l'échelle selon la nouvelle valeur maximale.
-			scaledValue := float64(pgm.data[y][x]) * float64(maxValue) / float64(pgm.max)
+			scaledValue := float64(pgm.value(x, y)) * float64(maxValue) / float64(pgm.max)
 
 			// Convertir la valeur à virgule flottante en entier non signé et mettre à jour la valeur du pixel.
-			newValue := uint8(scaledValue)
-			pgm.data[y][x] = newValue
+			scaled.putValue(x, y, uint16(scaledValue))
 		}
 	}
 
+	pgm.pix, pgm.stride = scaled.pix, scaled.stride
 	pgm.max = uint(maxValue)
+	pgm.record("SetMaxValue %d", maxValue)
 }
 
 // Rotate90CW fait pivoter l'image PGM de 90 degrés dans le sens des aiguilles d'une montre.
@@ -279,36 +288,31 @@ func (pgm *PGM) Rotate90CW() {
 		return
 	}
 
-	// Créer un nouveau tableau pour stocker les données pivotées.
-	newData := make([][]uint8, pgm.width)
-	for i := 0; i < pgm.width; i++ {
-		newData[i] = make([]uint8, pgm.height)
-		for j := 0; j < pgm.height; j++ {
-			// Effectuer la rotation en échangeant les indices i et j.
-			newData[i][j] = pgm.data[pgm.height-j-1][i]
+	// Créer un nouveau raster pour stocker les données pivotées.
+	rotated := newPGM(pgm.height, pgm.width, pgm.magicNumber, pgm.max)
+	for y := 0; y < rotated.height; y++ {
+		for x := 0; x < rotated.width; x++ {
+			// Effectuer la rotation en échangeant les indices.
+			rotated.putValue(x, y, pgm.value(y, pgm.height-x-1))
 		}
 	}
 
 	// Mettre à jour les données de l'image et échanger les dimensions.
-	pgm.data = newData
+	pgm.pix, pgm.stride = rotated.pix, rotated.stride
 	pgm.width, pgm.height = pgm.height, pgm.width
+	pgm.record("Rotate90CW")
 }
 
 // ToPBM convertit l'image PGM en une image PBM (Portable Bitmap).
 func (pgm *PGM) ToPBM() *PBM {
 	// Créer une nouvelle image PBM avec les mêmes dimensions.
-	pbm := &PBM{
-		data:        make([][]bool, pgm.height),
-		width:       pgm.width,
-		height:      pgm.height,
-		magicNumber: "P1",
-	}
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+	pbm.annotations = pgm.derive("ToPBM")
 
 	// Remplir les données de l'image PBM en convertissant les valeurs de pixels en valeurs booléennes.
 	for y := 0; y < pgm.height; y++ {
-		pbm.data[y] = make([]bool, pgm.width)
 		for x := 0; x < pgm.width; x++ {
-			pbm.data[y][x] = pgm.data[y][x] < uint8(pgm.max/2)
+			pbm.putBit(x, y, pgm.value(x, y) < uint16(pgm.max/2))
 		}
 	}
 
@@ -316,12 +320,24 @@ func (pgm *PGM) ToPBM() *PBM {
 	return pbm
 }
 
+// ToPAM convertit l'image PGM en une image PAM de type GRAYSCALE.
+func (pgm *PGM) ToPAM() *PAM {
+	pam := NewPAM(pgm.width, pgm.height, 1, pgm.max, TupleTypeGrayscale)
+	pam.annotations = pgm.derive("ToPAM")
+	for y := 0; y < pgm.height; y++ {
+		for x := 0; x < pgm.width; x++ {
+			pam.data[y][x] = pgm.value(x, y)
+		}
+	}
+	return pam
+}
+
 // PrintData affiche les données de l'image PGM.
 func (pgm *PGM) PrintData() {
 	// Parcourir chaque ligne et colonne de l'image et afficher la valeur du pixel.
 	for i := 0; i < pgm.height; i++ {
 		for j := 0; j < pgm.width; j++ {
-			fmt.Printf("%d ", pgm.data[i][j])
+			fmt.Printf("%d ", pgm.value(j, i))
 		}
 		fmt.Println()
 	}
@@ -3,24 +3,33 @@ package Netpbm
 import (
 	"bufio"
 	"fmt"
+	"image"
+	"image/color"
 	"io"
 	"math"
 	"os"
 	"sort"
-	"strings"
 )
 
 // Structure représentant une image PPM
 type PPM struct {
-	data          [][]Pixel
+	pix           []byte // composantes R, G, B comme en P6 : un octet, ou deux octets big-endian si max dépasse 255
+	stride        int    // octets par ligne de pix
 	width, height int
 	magicNumber   string
 	max           uint
+	annotations
 }
 
-// Structure représentant un pixel avec des composantes rouge, verte et bleue
+// Fonction newPPM crée une image PPM noire de width×height pixels.
+func newPPM(width, height int, magicNumber string, max uint) *PPM {
+	stride := 3 * width * bytesPerSample(max)
+	return &PPM{pix: make([]byte, stride*height), stride: stride, width: width, height: height, magicNumber: magicNumber, max: max}
+}
+
+// Structure représentant un pixel avec des composantes rouge, verte et bleue, sur 16 bits pour couvrir les valeurs maximales jusqu'à 65535
 type Pixel struct {
-	R, G, B uint8
+	R, G, B uint16
 }
 
 // Fonction ReadPPM lit une image PPM depuis un fichier et retourne une structure représentant l'image.
@@ -31,104 +40,40 @@ func ReadPPM(filename string) (*PPM, error) {
 	}
 	defer file.Close()
 
-	reader := bufio.NewReader(file)
-
-	// Lire magic number
-	magicNumber, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("error reading magic number: %v", err)
-	}
-	magicNumber = strings.TrimSpace(magicNumber)
-	if magicNumber != "P3" && magicNumber != "P6" {
-		return nil, fmt.Errorf("invalid magic number: %s", magicNumber)
-	}
+	return DecodePPM(file)
+}
 
-	// Lire les dimensions
-	dimensions, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("error reading dimensions: %v", err)
-	}
-	var width, height int
-	_, err = fmt.Sscanf(strings.TrimSpace(dimensions), "%d %d", &width, &height)
-	if err != nil {
-		return nil, fmt.Errorf("invalid dimensions: %v", err)
-	}
-	if width <= 0 || height <= 0 {
-		return nil, fmt.Errorf("invalid dimensions: width and height must be positive")
-	}
+// Fonction DecodePPM lit une image PPM (P3 ou P6) depuis r et retourne une structure représentant l'image.
+func DecodePPM(r io.Reader) (*PPM, error) {
+	return decodePPM(newTokenReader(r, nil))
+}
 
-	// Lire la valeur maximale
-	maxValue, err := reader.ReadString('\n')
+// Fonction decodePPM décode une image PPM depuis t, sans lire au-delà de son raster.
+func decodePPM(t *tokenReader) (*PPM, error) {
+	// Lire l'en-tête : magic number, dimensions et valeur maximale.
+	h, err := t.readHeader("P3", "P6")
 	if err != nil {
-		return nil, fmt.Errorf("error reading max value: %v", err)
-	}
-	maxValue = strings.TrimSpace(maxValue)
-	var max uint
-	_, err = fmt.Sscanf(maxValue, "%d", &max)
-	if err != nil {
-		return nil, fmt.Errorf("invalid max value: %v", err)
+		return nil, err
 	}
+	ppm := newPPM(h.Width, h.Height, h.MagicNumber, h.MaxValue)
+	ppm.comments = h.Comments
 
-	// Lire les données de l'image
-	data := make([][]Pixel, height)
-	expectedBytesPerPixel := 3
-
-	if magicNumber == "P3" {
-		// Lire le format P3 (ASCII)
-		for y := 0; y < height; y++ {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				return nil, fmt.Errorf("error reading data at row %d: %v", y, err)
-			}
-			fields := strings.Fields(line)
-			rowData := make([]Pixel, width)
-			for x := 0; x < width; x++ {
-				if x*3+2 >= len(fields) {
-					return nil, fmt.Errorf("index out of range at row %d, column %d", y, x)
-				}
-				var pixel Pixel
-				_, err := fmt.Sscanf(fields[x*3], "%d", &pixel.R)
-				if err != nil {
-					return nil, fmt.Errorf("error parsing Red value at row %d, column %d: %v", y, x, err)
-				}
-				_, err = fmt.Sscanf(fields[x*3+1], "%d", &pixel.G)
-				if err != nil {
-					return nil, fmt.Errorf("error parsing Green value at row %d, column %d: %v", y, x, err)
-				}
-				_, err = fmt.Sscanf(fields[x*3+2], "%d", &pixel.B)
-				if err != nil {
-					return nil, fmt.Errorf("error parsing Blue value at row %d, column %d: %v", y, x, err)
-				}
-				rowData[x] = pixel
-			}
-			data[y] = rowData
+	// Lire les données de l'image, ligne par ligne (P3 en ASCII, P6 en binaire).
+	rows := newRowReader(t, h)
+	samples := make([]uint16, 3*ppm.width)
+	size := bytesPerSample(ppm.max)
+	for y := 0; y < ppm.height; y++ {
+		if err := rows.ReadRow(samples); err != nil {
+			return nil, err
 		}
-	} else if magicNumber == "P6" {
-		// Lire le format P6 (binaire)
-		for y := 0; y < height; y++ {
-			row := make([]byte, width*expectedBytesPerPixel)
-			n, err := reader.Read(row)
-			if err != nil {
-				if err == io.EOF {
-					return nil, fmt.Errorf("unexpected end of file at row %d", y)
-				}
-				return nil, fmt.Errorf("error reading pixel data at row %d: %v", y, err)
-			}
-			if n < width*expectedBytesPerPixel {
-				return nil, fmt.Errorf("unexpected end of file at row %d, expected %d bytes, got %d", y, width*expectedBytesPerPixel, n)
-			}
-
-			rowData := make([]Pixel, width)
-			for x := 0; x < width; x++ {
-				pixel := Pixel{R: row[x*expectedBytesPerPixel], G: row[x*expectedBytesPerPixel+1], B: row[x*expectedBytesPerPixel+2]}
-				rowData[x] = pixel
-			}
-			data[y] = rowData
+		row := ppm.pix[y*ppm.stride:]
+		for i, sample := range samples {
+			putSample(row, i, size, sample)
 		}
 	}
 
 	// Retourner la structure PPM
-	return &PPM{data, width, height, magicNumber, max}, nil
+	return ppm, nil
 }
 
 // Fonction PrintPPM affiche les informations de base et les données des pixels de l'image PPM.
@@ -141,7 +86,7 @@ func (ppm *PPM) PrintPPM() {
 	fmt.Println("Pixel Data:")
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
-			pixel := ppm.data[y][x]
+			pixel := ppm.pixel(x, y)
 			fmt.Printf("(%d, %d, %d) ", pixel.R, pixel.G, pixel.B)
 		}
 		fmt.Println()
@@ -153,162 +98,294 @@ func (ppm *PPM) Size() (int, int) {
 	return ppm.width, ppm.height
 }
 
-// Fonction At retourne le pixel aux coordonnées spécifiées (x, y) dans l'image PPM.
-func (ppm *PPM) At(x, y int) Pixel {
+// Fonction MagicNumber retourne le magic number de l'image PPM.
+func (ppm *PPM) MagicNumber() string {
+	return ppm.magicNumber
+}
+
+// Fonction PixelAt retourne le pixel aux coordonnées spécifiées (x, y) dans l'image PPM.
+func (ppm *PPM) PixelAt(x, y int) Pixel {
 	// Vérification des limites pour éviter les erreurs d'index
 	if x < 0 || x >= ppm.width || y < 0 || y >= ppm.height {
 		panic("Index out of bounds")
 	}
 
-	return ppm.data[y][x]
+	return ppm.pixel(x, y)
 }
 
-// Fonction Set affecte la valeur d'un pixel aux coordonnées spécifiées (x, y) dans l'image PPM.
-func (ppm *PPM) Set(x, y int, value Pixel) {
-	// Vérification des limites pour éviter les erreurs d'index
+// Fonction Pix retourne le raster de l'image, partagé avec elle : Height lignes
+// de Stride octets au format P6, les composantes R, G et B de chaque pixel sur
+// un octet, ou deux octets big-endian si la valeur maximale dépasse 255.
+func (ppm *PPM) Pix() []byte {
+	return ppm.pix
+}
+
+// Fonction Stride retourne le nombre d'octets d'une ligne de Pix.
+func (ppm *PPM) Stride() int {
+	return ppm.stride
+}
+
+// Fonction pixel retourne le pixel en (x, y), sans vérifier les limites.
+func (ppm *PPM) pixel(x, y int) Pixel {
+	size := bytesPerSample(ppm.max)
+	row := ppm.pix[y*ppm.stride:]
+	return Pixel{R: getSample(row, 3*x, size), G: getSample(row, 3*x+1, size), B: getSample(row, 3*x+2, size)}
+}
+
+// Fonction putPixel définit le pixel en (x, y), sans vérifier les limites.
+func (ppm *PPM) putPixel(x, y int, pixel Pixel) {
+	size := bytesPerSample(ppm.max)
+	row := ppm.pix[y*ppm.stride:]
+	putSample(row, 3*x, size, pixel.R)
+	putSample(row, 3*x+1, size, pixel.G)
+	putSample(row, 3*x+2, size, pixel.B)
+}
+
+// Fonction ColorModel retourne color.RGBAModel, ou color.RGBA64Model si la valeur maximale dépasse 255 (image.Image).
+func (ppm *PPM) ColorModel() color.Model {
+	if ppm.max > 255 {
+		return color.RGBA64Model
+	}
+	return color.RGBAModel
+}
+
+// Fonction Bounds retourne le rectangle couvert par l'image PPM (image.Image).
+func (ppm *PPM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, ppm.width, ppm.height)
+}
+
+// Fonction At retourne la couleur opaque du pixel en (x, y), ramenée à la pleine échelle de color.RGBA ou color.RGBA64 (image.Image).
+func (ppm *PPM) At(x, y int) color.Color {
 	if x < 0 || x >= ppm.width || y < 0 || y >= ppm.height {
-		panic("Index out of bounds")
+		if ppm.max > 255 {
+			return color.RGBA64{}
+		}
+		return color.RGBA{}
 	}
 
-	ppm.data[y][x] = value
+	pixel := ppm.pixel(x, y)
+	if ppm.max > 255 {
+		return color.RGBA64{
+			R: scaleSample(pixel.R, ppm.max, 65535),
+			G: scaleSample(pixel.G, ppm.max, 65535),
+			B: scaleSample(pixel.B, ppm.max, 65535),
+			A: 65535,
+		}
+	}
+	return color.RGBA{
+		R: uint8(scaleSample(pixel.R, ppm.max, 255)),
+		G: uint8(scaleSample(pixel.G, ppm.max, 255)),
+		B: uint8(scaleSample(pixel.B, ppm.max, 255)),
+		A: 255,
+	}
+}
+
+// Fonction Set affecte la couleur d'un pixel aux coordonnées spécifiées (x, y) dans l'image PPM (draw.Image).
+func (ppm *PPM) Set(x, y int, c color.Color) {
+	rgba := color.RGBA64Model.Convert(c).(color.RGBA64)
+	ppm.SetPixel(Point{x, y}, Pixel{
+		R: scaleSample(rgba.R, 65535, ppm.max),
+		G: scaleSample(rgba.G, 65535, ppm.max),
+		B: scaleSample(rgba.B, 65535, ppm.max),
+	})
+}
+
+// Fonction PPMFromImage crée une image PPM (P3) à partir de n'importe quelle image.Image, sur 16 bits si la source l'est.
+func PPMFromImage(img image.Image) *PPM {
+	bounds := img.Bounds()
+	ppm := newPPM(bounds.Dx(), bounds.Dy(), "P3", maxValueOf(img))
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			ppm.Set(x, y, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return ppm
+}
+
+// La fonction scaleSample ramène une valeur de l'intervalle [0, from] à l'intervalle [0, to], avec arrondi.
+func scaleSample(value uint16, from, to uint) uint16 {
+	if from == 0 {
+		return 0
+	}
+	if uint(value) > from {
+		return uint16(to)
+	}
+	return uint16((uint(value)*to + from/2) / from)
+}
+
+// La fonction maxValueOf retourne 65535 pour les images 16 bits de la bibliothèque standard et 255 sinon.
+func maxValueOf(img image.Image) uint {
+	switch img.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model, color.Alpha16Model:
+		return 65535
+	}
+	return 255
 }
 
 // Fonction Save enregistre l'image PPM dans un fichier spécifié par le nom de fichier.
 func (ppm *PPM) Save(filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+	return saveFile(filename, ppm.Encode)
+}
+
+// Fonction Encode écrit l'image PPM dans w au format indiqué par le magic number (P3 ou P6).
+func (ppm *PPM) Encode(w io.Writer) error {
+	return ppm.encode(w, nil)
+}
+
+// Fonction encode écrit l'image PPM dans w, avec la mise en page ASCII choisie par o.
+func (ppm *PPM) encode(w io.Writer, o *EncodeOptions) error {
+	if ppm.magicNumber != "P6" && ppm.magicNumber != "P3" {
+		return fmt.Errorf("invalid magic number: %s", ppm.magicNumber)
 	}
-	defer file.Close()
-	if ppm.magicNumber == "P6" || ppm.magicNumber == "P3" {
-		fmt.Fprintf(file, "%s\n%d %d\n%d\n", ppm.magicNumber, ppm.width, ppm.height, ppm.max)
-	} else {
-		err = fmt.Errorf("magic number error")
+	writer := bufio.NewWriter(w)
+	h := o.header(Header{MagicNumber: ppm.magicNumber, Width: ppm.width, Height: ppm.height, MaxValue: ppm.max, Comments: ppm.comments})
+	if err := writeHeader(writer, h); err != nil {
 		return err
 	}
 
+	// Le raster est déjà au format P6 et s'écrit tel quel.
+	if ppm.magicNumber == "P6" {
+		if _, err := writer.Write(ppm.pix); err != nil {
+			return fmt.Errorf("error writing pixel data: %v", err)
+		}
+		return writer.Flush()
+	}
+
+	pw := newPlainWriter(writer, ppm.magicNumber, o)
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
-			pixel := ppm.data[y][x]
-			if ppm.magicNumber == "P6" {
-				// Conversion inverse des pixels
-				file.Write([]byte{pixel.R, pixel.G, pixel.B})
-			} else if ppm.magicNumber == "P3" {
-				// Conversion inverse des pixels
-				fmt.Fprintf(file, "%d %d %d ", pixel.R, pixel.G, pixel.B)
+			pixel := ppm.pixel(x, y)
+			var err error
+			for _, value := range [3]uint16{pixel.R, pixel.G, pixel.B} {
+				if err = pw.writeSample(value); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("error writing pixel data at row %d, column %d: %v", y, x, err)
 			}
 		}
-		if ppm.magicNumber == "P3" {
-			fmt.Fprint(file, "\n")
+		if err := pw.endRow(); err != nil {
+			return fmt.Errorf("error writing newline after row %d: %v", y, err)
 		}
 	}
 
-	return nil
+	return writer.Flush()
 }
 
 // Fonction Invert inverse les composantes de couleur de tous les pixels de l'image PPM.
 func (ppm *PPM) Invert() {
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
-			pixel := &ppm.data[y][x]
-			pixel.R = 255 - pixel.R
-			pixel.G = 255 - pixel.G
-			pixel.B = 255 - pixel.B
+			// Une composante au-delà de max, écrite par Pix, donne 0 au lieu de boucler.
+			pixel := ppm.clamp(ppm.pixel(x, y))
+			pixel.R = uint16(ppm.max) - pixel.R
+			pixel.G = uint16(ppm.max) - pixel.G
+			pixel.B = uint16(ppm.max) - pixel.B
+			ppm.putPixel(x, y, pixel)
 		}
 	}
+	ppm.record("Invert")
 }
 
 // Fonction Flip inverse l'ordre des pixels horizontalement dans l'image PPM.
 func (ppm *PPM) Flip() {
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width/2; x++ {
-			ppm.data[y][x], ppm.data[y][ppm.width-x-1] = ppm.data[y][ppm.width-x-1], ppm.data[y][x]
+			left, right := ppm.pixel(x, y), ppm.pixel(ppm.width-x-1, y)
+			ppm.putPixel(x, y, right)
+			ppm.putPixel(ppm.width-x-1, y, left)
 		}
 	}
+	ppm.record("Flip")
 }
 
 // Fonction Flop inverse l'ordre des lignes verticalement dans l'image PPM.
 func (ppm *PPM) Flop() {
-	for y := 0; y < ppm.height/2; y++ {
-		ppm.data[y], ppm.data[ppm.height-y-1] = ppm.data[ppm.height-y-1], ppm.data[y]
-	}
+	swapRows(ppm.pix, ppm.stride, ppm.height)
+	ppm.record("Flop")
 }
 
-// Fonction SetMagicNumber affecte le magic number d'une image PPM.
+// Fonction SetMagicNumber affecte le magic number d'une image PPM : "P3" ou "P6". Tout autre magic number est ignoré.
 func (ppm *PPM) SetMagicNumber(magicNumber string) {
-	ppm.magicNumber = magicNumber
+	if magicNumber == "P3" || magicNumber == "P6" {
+		ppm.magicNumber = magicNumber
+	}
 }
 
 // SetMaxValue met à jour la valeur maximale des pixels dans la structure PPM et ajuste les valeurs des pixels dans les données en fonction de la nouvelle valeur maximale.
-func (ppm *PPM) SetMaxValue(maxValue uint8) {
+func (ppm *PPM) SetMaxValue(maxValue uint16) {
+	// Le raster change de taille si les composantes passent d'un à deux octets.
+	scaled := newPPM(ppm.width, ppm.height, ppm.magicNumber, uint(maxValue))
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
 			// Mettre à l'échelle les valeurs RGB en fonction de la nouvelle valeur maximale
-			ppm.data[y][x].R = uint8(float64(ppm.data[y][x].R) * float64(maxValue) / float64(ppm.max))
-			ppm.data[y][x].G = uint8(float64(ppm.data[y][x].G) * float64(maxValue) / float64(ppm.max))
-			ppm.data[y][x].B = uint8(float64(ppm.data[y][x].B) * float64(maxValue) / float64(ppm.max))
+			pixel := ppm.pixel(x, y)
+			pixel.R = uint16(float64(pixel.R) * float64(maxValue) / float64(ppm.max))
+			pixel.G = uint16(float64(pixel.G) * float64(maxValue) / float64(ppm.max))
+			pixel.B = uint16(float64(pixel.B) * float64(maxValue) / float64(ppm.max))
+			scaled.putPixel(x, y, pixel)
 		}
 	}
 
 	// Mettre à jour la valeur maximale
+	ppm.pix, ppm.stride = scaled.pix, scaled.stride
 	ppm.max = uint(maxValue)
+	ppm.record("SetMaxValue %d", maxValue)
 }
 
 // Fonction Rotate90CW fait pivoter l'image PPM actuelle de 90 degrés dans le sens des aiguilles d'une montre.
 func (ppm *PPM) Rotate90CW() {
 	// Créer une nouvelle structure PPM pour contenir l'image pivotée
-	newPPM := PPM{
-		data:        make([][]Pixel, ppm.width),
-		width:       ppm.height,
-		height:      ppm.width,
-		magicNumber: ppm.magicNumber,
-		max:         ppm.max,
-	}
-
-	// Initialiser le tableau bidimensionnel dans la nouvelle structure PPM
-	for i := range newPPM.data {
-		newPPM.data[i] = make([]Pixel, newPPM.width)
-	}
+	newPPM := newPPM(ppm.height, ppm.width, ppm.magicNumber, ppm.max)
+	newPPM.annotations = ppm.annotations
 
 	// Effectuer la rotation en copiant les pixels de l'image actuelle vers la nouvelle structure pivotée
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
-			newPPM.data[x][ppm.height-y-1] = ppm.data[y][x]
+			newPPM.putPixel(ppm.height-y-1, x, ppm.pixel(x, y))
 		}
 	}
 
 	// Mettre à jour la structure PPM actuelle avec la nouvelle image pivotée
-	*ppm = newPPM
+	*ppm = *newPPM
+	ppm.record("Rotate90CW")
 }
 
 // Fonction ToPGM convertit l'image PPM en une image PGM (niveaux de gris).
 func (ppm *PPM) ToPGM() *PGM {
 	// Créer une nouvelle structure PGM pour contenir l'image en niveaux de gris
-	pgm := &PGM{
-		width:       ppm.width,
-		height:      ppm.height,
-		magicNumber: "P2",
-		max:         ppm.max,
-	}
-
-	// Initialiser le tableau bidimensionnel dans la nouvelle structure PGM
-	pgm.data = make([][]uint8, ppm.height)
-	for i := range pgm.data {
-		pgm.data[i] = make([]uint8, ppm.width)
-	}
+	pgm := newPGM(ppm.width, ppm.height, "P2", ppm.max)
+	pgm.annotations = ppm.derive("ToPGM")
 
 	// Convertir chaque pixel RGB en niveaux de gris et les assigner à la nouvelle structure PGM
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
 			// Convertir RGB en niveaux de gris
-			gray := uint8((int(ppm.data[y][x].R) + int(ppm.data[y][x].G) + int(ppm.data[y][x].B)) / 3)
-			pgm.data[y][x] = gray
+			pixel := ppm.pixel(x, y)
+			gray := uint16((int(pixel.R) + int(pixel.G) + int(pixel.B)) / 3)
+			pgm.putValue(x, y, gray)
 		}
 	}
 
 	return pgm
 }
 
+// Fonction ToPAM convertit l'image PPM en une image PAM de type RGB.
+func (ppm *PPM) ToPAM() *PAM {
+	pam := NewPAM(ppm.width, ppm.height, 3, ppm.max, TupleTypeRGB)
+	pam.annotations = ppm.derive("ToPAM")
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
+			pixel := ppm.pixel(x, y)
+			pam.data[y][3*x] = pixel.R
+			pam.data[y][3*x+1] = pixel.G
+			pam.data[y][3*x+2] = pixel.B
+		}
+	}
+	return pam
+}
+
 // Structure représentant un point avec des coordonnées X et Y.
 type Point struct {
 	X, Y int
@@ -316,40 +393,38 @@ type Point struct {
 
 // Fonction ToPBM convertit l'image PPM en une image PBM (noir et blanc).
 func (ppm *PPM) ToPBM() *PBM {
-	pbm := &PBM{
-		width:       ppm.width,
-		height:      ppm.height,
-		magicNumber: "P1",
-	}
-
-	// Initialiser le tableau bidimensionnel dans la nouvelle structure PBM
-	pbm.data = make([][]bool, ppm.height)
-	for i := range pbm.data {
-		pbm.data[i] = make([]bool, ppm.width)
-	}
+	pbm := newPBM(ppm.width, ppm.height, "P1")
+	pbm.annotations = ppm.derive("ToPBM")
 
 	// Définir le seuil pour la conversion en noir et blanc
-	threshold := uint8(ppm.max / 2)
+	threshold := uint16(ppm.max / 2)
 
 	// Convertir chaque pixel en noir et blanc et les assigner à la nouvelle structure PBM
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
-			average := (uint16(ppm.data[y][x].R) + uint16(ppm.data[y][x].G) + uint16(ppm.data[y][x].B)) / 3
-			pbm.data[y][x] = average > uint16(threshold)
+			pixel := ppm.pixel(x, y)
+			average := (uint32(pixel.R) + uint32(pixel.G) + uint32(pixel.B)) / 3
+			pbm.putBit(x, y, average > uint32(threshold))
 		}
 	}
 
 	return pbm
 }
 
-// Fonction SetPixel définit la couleur d'un pixel à une position spécifiée dans l'image PPM.
+// Fonction SetPixel définit la couleur d'un pixel à une position spécifiée dans l'image PPM, chaque composante étant ramenée à la valeur maximale si elle la dépasse.
 func (ppm *PPM) SetPixel(p Point, color Pixel) {
 	// Vérifier si le point est dans les dimensions de l'image PPM.
 	if p.X >= 0 && p.X < ppm.width && p.Y >= 0 && p.Y < ppm.height {
-		ppm.data[p.Y][p.X] = color
+		ppm.putPixel(p.X, p.Y, ppm.clamp(color))
 	}
 }
 
+// Fonction clamp ramène chaque composante de pixel à la valeur maximale de l'image PPM.
+func (ppm *PPM) clamp(pixel Pixel) Pixel {
+	max := uint16(ppm.max)
+	return Pixel{R: min(pixel.R, max), G: min(pixel.G, max), B: min(pixel.B, max)}
+}
+
 // Fonction DrawLine utilise l'algorithme de Bresenham pour dessiner une ligne entre deux points dans l'image PPM.
 func (ppm *PPM) DrawLine(p1, p2 Point, color Pixel) {
 	// Algorithme de tracé de ligne de Bresenham
@@ -415,12 +490,12 @@ func (ppm *PPM) DrawFilledRectangle(p1 Point, width, height int, color Pixel) {
 			// Si la largeur du rectangle est dans les données du fichier
 			if p1.X+width < ppm.width {
 				for x := p1.X; x <= p1.X+width; x++ {
-					ppm.data[y][x] = color
+					ppm.SetPixel(Point{X: x, Y: y}, color)
 				}
 				// Si la largeur du rectangle dépasse les données du fichier
 			} else if p1.X+width > ppm.width {
 				for x := p1.X; x < ppm.width; x++ {
-					ppm.data[y][x] = color
+					ppm.SetPixel(Point{X: x, Y: y}, color)
 				}
 			}
 		}
@@ -430,12 +505,12 @@ func (ppm *PPM) DrawFilledRectangle(p1 Point, width, height int, color Pixel) {
 			// Si la largeur du rectangle est dans les données du fichier
 			if p1.X+width < ppm.width {
 				for x := p1.X; x <= p1.X+width; x++ {
-					ppm.data[y][x] = color
+					ppm.SetPixel(Point{X: x, Y: y}, color)
 				}
 				// Si la largeur du rectangle dépasse les données du fichier
 			} else if p1.X+width > ppm.width {
 				for x := p1.X; x < ppm.width; x++ {
-					ppm.data[y][x] = color
+					ppm.SetPixel(Point{X: x, Y: y}, color)
 				}
 			}
 		}
@@ -444,6 +519,7 @@ func (ppm *PPM) DrawFilledRectangle(p1 Point, width, height int, color Pixel) {
 
 // Fonction DrawCircle dessine un cercle avec le centre, le rayon et la couleur spécifiés.
 func (ppm *PPM) DrawCircle(center Point, radius int, color Pixel) {
+	color = ppm.clamp(color)
 	// Parcourir chaque pixel
 	for y := 0; y < ppm.height; y++ {
 		for x := 0; x < ppm.width; x++ {
@@ -453,7 +529,7 @@ func (ppm *PPM) DrawCircle(center Point, radius int, color Pixel) {
 			distance := math.Sqrt(dx*dx + dy*dy)
 			// Vérifier si la distance est approximativement égale au rayon spécifié
 			if math.Abs(distance-float64(radius)*0.85) < 0.5 {
-				ppm.data[y][x] = color
+				ppm.putPixel(x, y, color)
 			}
 		}
 	}
@@ -502,6 +578,9 @@ func (ppm *PPM) DrawPolygon(points []Point, color Pixel) {
 }
 
 func (ppm *PPM) DrawFilledPolygon(points []Point, color Pixel) {
+	// Le contour est écrit par SetPixel, qui ramène la couleur à la valeur maximale.
+	color = ppm.clamp(color)
+
 	// Dessine le contour du polygone
 	ppm.DrawPolygon(points, color)
 
@@ -514,7 +593,7 @@ func (ppm *PPM) DrawFilledPolygon(points []Point, color Pixel) {
 
 		// Parcourt chaque colonne de la ligne
 		for j := 0; j < ppm.width; j++ {
-			if ppm.data[i][j] == color {
+			if ppm.pixel(j, i) == color {
 				number_points++
 				positions = append(positions, j)
 			}
@@ -523,7 +602,7 @@ func (ppm *PPM) DrawFilledPolygon(points []Point, color Pixel) {
 		// Si plus d'un point, remplir la zone entre les deux premiers points
 		if number_points > 1 {
 			for k := positions[0] + 1; k < positions[len(positions)-1]; k++ {
-				ppm.data[i][k] = color
+				ppm.putPixel(k, i, color)
 			}
 		}
 	}
@@ -618,7 +697,7 @@ func (ppm *PPM) DrawPerlinNoise(color1 Pixel, color2 Pixel) {
 			noiseValue := perlinNoise(float64(x)*frequency, float64(y)*frequency) * amplitude
 			normalizedValue := (noiseValue + amplitude) / (2 * amplitude)
 			interpolatedColor := interpolateColors(color1, color2, normalizedValue)
-			ppm.Set(x, y, interpolatedColor)
+			ppm.SetPixel(Point{x, y}, interpolatedColor)
 		}
 	}
 }
@@ -635,9 +714,9 @@ func perlinNoise(x, y float64) float64 {
 // La fonction interpolateColors effectue une interpolation linéaire entre deux couleurs (color1 et color2) en utilisant le facteur t (dans la plage [0, 1]).
 func interpolateColors(color1 Pixel, color2 Pixel, t float64) Pixel {
 	// Interpole séparément chaque composante RGB des deux couleurs.
-	r := uint8(float64(color1.R)*(1-t) + float64(color2.R)*t)
-	g := uint8(float64(color1.G)*(1-t) + float64(color2.G)*t)
-	b := uint8(float64(color1.B)*(1-t) + float64(color2.B)*t)
+	r := uint16(float64(color1.R)*(1-t) + float64(color2.R)*t)
+	g := uint16(float64(color1.G)*(1-t) + float64(color2.G)*t)
+	b := uint16(float64(color1.B)*(1-t) + float64(color2.B)*t)
 
 	// Retourne la nouvelle couleur interpolée.
 	return Pixel{R: r, G: g, B: b}
@@ -665,18 +744,8 @@ func (ppm *PPM) KNearestNeighbors(newWidth, newHeight int) {
 	scaleY := float64(ppm.height) / float64(newHeight)
 
 	// Créer une nouvelle image PPM avec les dimensions souhaitées
-	resizedPPM := &PPM{
-		data:        make([][]Pixel, newHeight),
-		width:       newWidth,
-		height:      newHeight,
-		magicNumber: ppm.magicNumber,
-		max:         ppm.max,
-	}
-
-	// Initialiser les données de pixels pour l'image redimensionnée
-	for i := range resizedPPM.data {
-		resizedPPM.data[i] = make([]Pixel, newWidth)
-	}
+	resizedPPM := newPPM(newWidth, newHeight, ppm.magicNumber, ppm.max)
+	resizedPPM.annotations = ppm.annotations
 
 	// Itérer sur chaque pixel de l'image redimensionnée
 	for y := 0; y < newHeight; y++ {
@@ -694,7 +763,7 @@ func (ppm *PPM) KNearestNeighbors(newWidth, newHeight int) {
 
 					// S'assurer que les coordonnées sont dans les limites de l'image originale
 					if nx >= 0 && nx < ppm.width && ny >= 0 && ny < ppm.height {
-						neighbors = append(neighbors, ppm.data[ny][nx])
+						neighbors = append(neighbors, ppm.pixel(nx, ny))
 					}
 				}
 			}
@@ -707,15 +776,16 @@ func (ppm *PPM) KNearestNeighbors(newWidth, newHeight int) {
 				totalB += uint64(color.B)
 			}
 
-			avgR := uint8(totalR / uint64(len(neighbors)))
-			avgG := uint8(totalG / uint64(len(neighbors)))
-			avgB := uint8(totalB / uint64(len(neighbors)))
+			avgR := uint16(totalR / uint64(len(neighbors)))
+			avgG := uint16(totalG / uint64(len(neighbors)))
+			avgB := uint16(totalB / uint64(len(neighbors)))
 
 			// Définir la couleur du pixel dans l'image redimensionnée
-			resizedPPM.data[y][x] = Pixel{R: avgR, G: avgG, B: avgB}
+			resizedPPM.putPixel(x, y, Pixel{R: avgR, G: avgG, B: avgB})
 		}
 	}
 
 	// Remplacer l'image originale par l'image redimensionnée
 	*ppm = *resizedPPM
+	ppm.record("KNearestNeighbors %dx%d", newWidth, newHeight)
 }
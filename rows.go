@@ -0,0 +1,402 @@
+package Netpbm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RowReader lit une image PBM, PGM, PPM ou PAM ligne par ligne, sans jamais
+// garder plus d'une ligne en mémoire.
+//
+// Une ligne contient Width*Depth échantillons entrelacés. Pour les PBM, un
+// échantillon vaut 1 pour un pixel noir et 0 pour un pixel blanc.
+type RowReader struct {
+	t      *tokenReader
+	header *Header
+	row    int    // indice de la prochaine ligne à lire
+	buf    []byte // tampon d'une ligne binaire
+
+	truncated bool // fin du raster atteinte en mode tolérant
+}
+
+// NewRowReader lit l'en-tête de r et retourne un RowReader positionné sur la première ligne.
+func NewRowReader(r io.Reader) (*RowReader, error) {
+	return newRowReaderFrom(newTokenReader(r, nil))
+}
+
+// newRowReaderFrom lit l'en-tête depuis t et retourne un RowReader positionné sur la première ligne.
+func newRowReaderFrom(t *tokenReader) (*RowReader, error) {
+	h, err := t.readHeader("P1", "P2", "P3", "P4", "P5", "P6", "P7")
+	if err != nil {
+		return nil, err
+	}
+	return newRowReader(t, h), nil
+}
+
+// newRowReader crée un RowReader sur le raster qui suit l'en-tête h.
+func newRowReader(t *tokenReader, h *Header) *RowReader {
+	rr := &RowReader{t: t, header: h}
+	switch h.MagicNumber {
+	case "P4":
+		rr.buf = make([]byte, (h.Width+7)/8)
+	case "P5", "P6", "P7":
+		rr.buf = make([]byte, h.Width*h.Depth*bytesPerSample(h.MaxValue))
+	}
+	return rr
+}
+
+// Header retourne l'en-tête de l'image.
+func (rr *RowReader) Header() *Header {
+	return rr.header
+}
+
+// ReadRow remplit row avec les échantillons de la ligne suivante et retourne
+// io.EOF une fois toutes les lignes lues. row doit contenir au moins
+// Width*Depth éléments.
+func (rr *RowReader) ReadRow(row []uint16) error {
+	h := rr.header
+	if rr.row >= h.Height {
+		return io.EOF
+	}
+	n := h.Width * h.Depth
+	if len(row) < n {
+		return fmt.Errorf("row buffer too small: %d samples, need %d", len(row), n)
+	}
+	y := rr.row
+
+	if rr.truncated {
+		// Raster incomplet en mode tolérant : les lignes manquantes sont nulles.
+		clear(row[:n])
+		rr.row++
+		return nil
+	}
+
+	switch h.MagicNumber {
+	case "P1", "P2", "P3":
+		// Formats ASCII : un token par échantillon.
+		for i := 0; i < n; i++ {
+			value, err := rr.readASCII(y, i/h.Depth)
+			if err == errTruncatedRow {
+				clear(row[i:n])
+				break
+			}
+			if err != nil {
+				return err
+			}
+			row[i] = value
+		}
+	case "P4":
+		// Format binaire PBM : un bit par pixel, le bit de poids fort en premier.
+		if err := rr.readBinary(y); err != nil {
+			return err
+		}
+		for x := 0; x < n; x++ {
+			row[x] = uint16(rr.buf[x/8]>>(7-x%8)) & 1
+		}
+	default:
+		// Formats binaires PGM, PPM et PAM : un ou deux octets big-endian par échantillon.
+		if err := rr.readBinary(y); err != nil {
+			return err
+		}
+		size := bytesPerSample(h.MaxValue)
+		for i := 0; i < n; i++ {
+			row[i] = getSample(rr.buf, i, size)
+			if uint(row[i]) > h.MaxValue {
+				if err := rr.t.offSpec(ErrSampleOutOfRange, y, i/h.Depth, "sample %d exceeds max value %d", row[i], h.MaxValue); err != nil {
+					return err
+				}
+				row[i] = uint16(h.MaxValue)
+			}
+		}
+	}
+
+	rr.row++
+	return nil
+}
+
+// errTruncatedRow signale à ReadRow que le raster ASCII s'est arrêté avant la
+// fin de la ligne et que l'écart a été accepté en mode tolérant.
+var errTruncatedRow = errors.New("truncated row")
+
+// readASCII lit l'échantillon suivant d'un raster ASCII, en le ramenant à la
+// valeur maximale ou à zéro en mode tolérant.
+func (rr *RowReader) readASCII(y, x int) (uint16, error) {
+	h := rr.header
+	if h.MagicNumber == "P1" && rr.t.lenient() {
+		return rr.readBit(y, x)
+	}
+
+	field, err := rr.t.token()
+	if err != nil {
+		return 0, rr.truncate(err, y, x)
+	}
+	value, err := strconv.ParseUint(field, 10, 16)
+	switch {
+	case err != nil && !errors.Is(err, strconv.ErrRange):
+		if err := rr.t.offSpec(ErrBadSample, y, x, "invalid sample %q", field); err != nil {
+			return 0, err
+		}
+		return 0, nil
+	case h.MagicNumber == "P1" && len(field) > 1 && strings.Trim(field, "01") == "":
+		// Le mode tolérant ne passe pas ici : le mode tolérant lit P1 chiffre par chiffre.
+		return 0, rr.t.errorf(ErrMissingSpace, y, x, "missing whitespace between samples %q", field)
+	case err != nil || uint(value) > h.MaxValue:
+		if err := rr.t.offSpec(ErrSampleOutOfRange, y, x, "sample %s exceeds max value %d", field, h.MaxValue); err != nil {
+			return 0, err
+		}
+		return uint16(h.MaxValue), nil
+	}
+	return uint16(value), nil
+}
+
+// readBit lit un pixel P1 en mode tolérant, où les chiffres peuvent être
+// accolés comme dans "0110".
+func (rr *RowReader) readBit(y, x int) (uint16, error) {
+	c, err := rr.t.skipSpace()
+	if err != nil {
+		return 0, rr.truncate(err, y, x)
+	}
+	switch {
+	case c == '0' || c == '1':
+		return uint16(c - '0'), nil
+	case c >= '2' && c <= '9':
+		return 1, rr.t.offSpec(ErrSampleOutOfRange, y, x, "sample %c exceeds max value 1", c)
+	}
+	return 0, rr.t.offSpec(ErrBadSample, y, x, "invalid sample %q", c)
+}
+
+// truncate traite une erreur de lecture dans le raster ASCII : en mode
+// tolérant, une fin de flux prématurée retourne errTruncatedRow et les
+// échantillons restants valent zéro.
+func (rr *RowReader) truncate(err error, y, x int) error {
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return rr.t.ioError(err, y, x, "pixel data")
+	}
+	if err := rr.t.offSpec(ErrTruncated, y, x, "unexpected end of file reading pixel data, padding with zeros"); err != nil {
+		return rr.t.ioError(io.ErrUnexpectedEOF, y, x, "pixel data")
+	}
+	rr.truncated = true
+	return errTruncatedRow
+}
+
+// readPackedRow lit la ligne P4 suivante directement dans les mots de dst,
+// le premier octet dans les bits de poids fort du premier mot. Les bits de
+// remplissage de fin de ligne sont recopiés tels quels.
+func (rr *RowReader) readPackedRow(dst []uint64) error {
+	if rr.row >= rr.header.Height {
+		return io.EOF
+	}
+	if rr.truncated {
+		clear(rr.buf)
+	} else if err := rr.readBinary(rr.row); err != nil {
+		return err
+	}
+	var word [8]byte
+	for i := range dst {
+		clear(word[:])
+		if 8*i < len(rr.buf) {
+			copy(word[:], rr.buf[8*i:])
+		}
+		dst[i] = binary.BigEndian.Uint64(word[:])
+	}
+	rr.row++
+	return nil
+}
+
+// readBinary lit exactement une ligne binaire dans rr.buf. En mode tolérant,
+// une ligne incomplète est complétée par des zéros.
+func (rr *RowReader) readBinary(y int) error {
+	n, err := rr.t.read(rr.buf)
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return rr.t.ioError(err, y, -1, "pixel data")
+		}
+		if err := rr.t.offSpec(ErrTruncated, y, -1, "unexpected end of file, expected %d bytes, got %d", len(rr.buf), n); err != nil {
+			return err
+		}
+		clear(rr.buf[n:])
+		rr.truncated = true
+	}
+	return nil
+}
+
+// RowWriter écrit une image PBM, PGM, PPM ou PAM ligne par ligne dans un io.Writer.
+type RowWriter struct {
+	w      *bufio.Writer
+	header Header
+	row    int    // nombre de lignes déjà écrites
+	buf    []byte // tampon d'une ligne binaire
+}
+
+// NewRowWriter écrit l'en-tête h dans w et retourne un RowWriter prêt à
+// recevoir les lignes. Depth est déduit du magic number pour P1 à P6.
+func NewRowWriter(w io.Writer, h Header) (*RowWriter, error) {
+	switch h.MagicNumber {
+	case "P1", "P4":
+		h.Depth, h.MaxValue = 1, 1
+	case "P2", "P5":
+		h.Depth = 1
+	case "P3", "P6":
+		h.Depth = 3
+	case "P7":
+	default:
+		return nil, fmt.Errorf("invalid magic number: %s", h.MagicNumber)
+	}
+	if h.Width <= 0 || h.Height <= 0 || h.Depth <= 0 {
+		return nil, fmt.Errorf("invalid dimensions: width, height and depth must be positive")
+	}
+	if h.MaxValue == 0 || h.MaxValue > 65535 {
+		return nil, fmt.Errorf("invalid max value: %d", h.MaxValue)
+	}
+
+	rw := &RowWriter{w: bufio.NewWriter(w), header: h}
+	switch h.MagicNumber {
+	case "P4":
+		rw.buf = make([]byte, (h.Width+7)/8)
+	case "P5", "P6", "P7":
+		rw.buf = make([]byte, h.Width*h.Depth*bytesPerSample(h.MaxValue))
+	}
+
+	if err := writeHeader(rw.w, &h); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// WriteRow écrit les Width*Depth premiers échantillons de row comme ligne
+// suivante. Comme avec SetValue, un échantillon au-delà de MaxValue est
+// ramené à MaxValue.
+func (rw *RowWriter) WriteRow(row []uint16) error {
+	h := &rw.header
+	if rw.row >= h.Height {
+		return fmt.Errorf("too many rows: image has %d rows", h.Height)
+	}
+	n := h.Width * h.Depth
+	if len(row) < n {
+		return fmt.Errorf("row too short: %d samples, need %d", len(row), n)
+	}
+
+	var err error
+	switch h.MagicNumber {
+	case "P1", "P2", "P3":
+		// Formats ASCII : lignes d'au plus 70 caractères, chaque ligne d'image
+		// commençant sur une nouvelle ligne.
+		pw := newPlainWriter(rw.w, h.MagicNumber, nil)
+		for i := 0; i < n && err == nil; i++ {
+			err = pw.writeSample(min(row[i], uint16(h.MaxValue)))
+		}
+		if err == nil {
+			err = pw.endRow()
+		}
+	case "P4":
+		for i := range rw.buf {
+			rw.buf[i] = 0
+		}
+		for x := 0; x < n; x++ {
+			if row[x] != 0 {
+				rw.buf[x/8] |= 1 << (7 - x%8)
+			}
+		}
+		_, err = rw.w.Write(rw.buf)
+	default:
+		size := bytesPerSample(h.MaxValue)
+		for i := 0; i < n; i++ {
+			putSample(rw.buf, i, size, min(row[i], uint16(h.MaxValue)))
+		}
+		_, err = rw.w.Write(rw.buf)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing pixel data at row %d: %v", rw.row, err)
+	}
+
+	rw.row++
+	return nil
+}
+
+// Close vide le tampon et vérifie que toutes les lignes ont été écrites. Le
+// io.Writer sous-jacent n'est pas fermé.
+func (rw *RowWriter) Close() error {
+	if err := rw.w.Flush(); err != nil {
+		return err
+	}
+	if rw.row != rw.header.Height {
+		return fmt.Errorf("incomplete image: %d of %d rows written", rw.row, rw.header.Height)
+	}
+	return nil
+}
+
+// writeHeader écrit l'en-tête h au format indiqué par son magic number, avec
+// ses commentaires juste après le magic number.
+func writeHeader(w io.Writer, h *Header) error {
+	_, err := fmt.Fprintln(w, h.MagicNumber)
+	if err == nil {
+		err = writeComments(w, h.Comments)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing header: %v", err)
+	}
+
+	switch h.MagicNumber {
+	case "P1", "P4":
+		_, err = fmt.Fprintf(w, "%d %d\n", h.Width, h.Height)
+	case "P7":
+		_, err = fmt.Fprintf(w, "WIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\n", h.Width, h.Height, h.Depth, h.MaxValue)
+		if err == nil && h.TupleType != "" {
+			_, err = fmt.Fprintf(w, "TUPLTYPE %s\n", h.TupleType)
+		}
+		if err == nil {
+			_, err = fmt.Fprintln(w, "ENDHDR")
+		}
+	default:
+		_, err = fmt.Fprintf(w, "%d %d\n%d\n", h.Width, h.Height, h.MaxValue)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing header: %v", err)
+	}
+	return nil
+}
+
+// InvertRow inverse les échantillons d'une ligne par rapport à la valeur
+// maximale de h, comme PAM.Invert : le canal alpha d'un type de tuple
+// "*_ALPHA" est conservé et un échantillon au-delà de la valeur maximale
+// donne 0.
+func InvertRow(row []uint16, h *Header) {
+	depth, colors := max(h.Depth, 1), max(h.Depth, 1)
+	if strings.HasSuffix(h.TupleType, "_ALPHA") && depth > 1 {
+		colors--
+	}
+	for i := range row {
+		if i%depth < colors {
+			row[i] = uint16(h.MaxValue) - min(row[i], uint16(h.MaxValue))
+		}
+	}
+}
+
+// GrayRow écrit dans dst la moyenne des composantes de chaque pixel de src,
+// comme PPM.ToPGM ; src suit l'en-tête h.
+func GrayRow(dst, src []uint16, h *Header) {
+	for x := 0; x < h.Width; x++ {
+		if h.Depth < 3 {
+			dst[x] = src[x*h.Depth]
+			continue
+		}
+		pixel := src[x*h.Depth : x*h.Depth+3]
+		dst[x] = uint16((uint32(pixel[0]) + uint32(pixel[1]) + uint32(pixel[2])) / 3)
+	}
+}
+
+// ThresholdRow écrit dans dst une ligne PBM : 1 (noir) pour chaque échantillon de src inférieur à threshold.
+func ThresholdRow(dst, src []uint16, threshold uint16) {
+	for i, value := range src {
+		if value < threshold {
+			dst[i] = 1
+		} else {
+			dst[i] = 0
+		}
+	}
+}
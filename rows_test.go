@@ -0,0 +1,54 @@
+package Netpbm
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestWriteRowClampsToMaxValue(t *testing.T) {
+	tests := []struct {
+		header Header
+		row    []uint16
+		want   string
+	}{
+		{Header{MagicNumber: "P5", Width: 2, Height: 1, MaxValue: 255}, []uint16{300, 7}, "P5\n2 1\n255\n\xff\x07"},
+		{Header{MagicNumber: "P2", Width: 2, Height: 1, MaxValue: 10}, []uint16{300, 7}, "P2\n2 1\n10\n10 7\n"},
+		{Header{MagicNumber: "P1", Width: 2, Height: 1}, []uint16{5, 0}, "P1\n2 1\n1 0\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		rw, err := NewRowWriter(&buf, tt.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rw.WriteRow(tt.row); err != nil {
+			t.Fatal(err)
+		}
+		if err := rw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: wrote %q, want %q", tt.header.MagicNumber, buf.String(), tt.want)
+		}
+		if _, err := DecodeAny(&buf); err != nil {
+			t.Errorf("%s: output does not decode: %v", tt.header.MagicNumber, err)
+		}
+	}
+}
+
+func TestInvertRowKeepsAlpha(t *testing.T) {
+	h := &Header{MagicNumber: "P7", Width: 2, Depth: 2, MaxValue: 255, TupleType: TupleTypeGrayscaleAlpha}
+	row := []uint16{10, 200, 300, 50}
+	InvertRow(row, h)
+	if want := []uint16{245, 200, 0, 50}; !slices.Equal(row, want) {
+		t.Errorf("InvertRow gave %v, want %v", row, want)
+	}
+
+	h.TupleType = TupleTypeGrayscale
+	row = []uint16{10, 200}
+	InvertRow(row, h)
+	if want := []uint16{245, 55}; !slices.Equal(row, want) {
+		t.Errorf("InvertRow without alpha gave %v, want %v", row, want)
+	}
+}
@@ -0,0 +1,63 @@
+package Netpbm
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reader lit une suite d'images Netpbm concaténées dans un même flux, comme le
+// permet la spécification (par exemple les trames d'une caméra sur un pipe).
+type Reader struct {
+	t *tokenReader
+}
+
+// NewReader crée un Reader qui lit les images successives de r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{t: newTokenReader(r, nil)}
+}
+
+// Next retourne l'image suivante du flux, quel que soit son format, ou io.EOF
+// lorsque le flux ne contient plus d'image.
+func (r *Reader) Next() (Image, error) {
+	// La limite MaxBytes s'applique à chaque image séparément.
+	r.t.start = r.t.off
+
+	// Ignorer les blancs qui suivent le raster ASCII de l'image précédente.
+	for {
+		c, err := r.t.readByte()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, r.t.ioError(err, -1, -1, "stream")
+		}
+		if !isSpace(c) {
+			r.t.unreadByte()
+			break
+		}
+	}
+
+	// Chaque image a ses propres commentaires d'en-tête.
+	r.t.comments = nil
+	return decodeAny(r.t)
+}
+
+// Writer écrit une suite d'images Netpbm à la suite les unes des autres.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter crée un Writer qui ajoute les images à w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write ajoute img au flux dans son format courant.
+func (w *Writer) Write(img Image) error {
+	return img.Encode(w.w)
+}
+
+// Flush écrit dans le flux sous-jacent les données encore en tampon.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}